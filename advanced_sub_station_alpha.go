@@ -0,0 +1,143 @@
+/*
+
+This file implements reading and writing the Advanced Sub Station Alpha file format (*.ass).
+It can parse *.ass files and create model from them.
+And it can also generate Advanced Sub Station Alpha content from a model.
+
+Advanced Sub Station Alpha (v4.00+) is the successor of Sub Station Alpha (v4),
+the parser is shared with the Sub Station Alpha format (see sub_station_alpha.go).
+
+Format specifications:
+https://en.wikipedia.org/wiki/SubStation_Alpha
+http://moodub.free.fr/video/ass-specs.doc
+
+An example ASS file:
+
+	[Script Info]
+	ScriptType: v4.00+
+	WrapStyle: 0
+	ScaledBorderAndShadow: yes
+	PlayResX: 800
+	PlayResY: 600
+
+	[V4+ Styles]
+	Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut,
+	   ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+	Style: Default,Arial,28,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,-1,0,0,0,100,100,0,0,1,1,2,2,30,30,30,1
+
+	[Events]
+	Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+	Dialogue: 0,0:02:17.44,0:02:20.37,Default,,0,0,0,,Senator, we're making\Nour final approach into Coruscant.
+
+*/
+
+package srtgears
+
+import (
+	"io"
+	"os"
+)
+
+// Mapping between *.ass Alignment (numpad layout) to our model Pos
+var assPosToModelPos = map[int]Pos{
+	7: TopLeft, 8: Top, 9: TopRight,
+	4: Left, 5: Center, 6: Right,
+	1: BottomLeft, 2: Bottom, 3: BottomRight,
+}
+
+// Mapping between our model Pos to *.ass Alignment (numpad layout)
+var modelPosToAssPos = map[Pos]int{
+	TopLeft: 7, Top: 8, TopRight: 9,
+	Left: 4, Center: 5, Right: 6,
+	BottomLeft: 1, Bottom: 2, BottomRight: 3,
+}
+
+// ReadAssFile reads and parses an Advanced Sub Station Alpha file (*.ass) and builds the model from it.
+func ReadAssFile(name string) (sp *SubsPack, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Reading from file: %s", name)
+	return ReadAssFrom(f)
+}
+
+// ReadAssFrom reads and parses an Advanced Sub Station Alpha from an io.Reader (*.ass) and builds the model from it.
+func ReadAssFrom(r io.Reader) (sp *SubsPack, err error) {
+	return ReadSsaFrom(r)
+}
+
+// WriteAssFile generates Advanced Sub Station Alpha format (*.ass) and writes it to a file.
+func WriteAssFile(name string, sp *SubsPack) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Writing %d subtitles to file: %s", len(sp.Subs), name)
+	return WriteAssTo(f, sp)
+}
+
+// WriteAssTo generates Advanced Sub Station Alpha format (*.ass) and writes it to an io.Writer.
+func WriteAssTo(w io.Writer, sp *SubsPack) (err error) {
+	wr := &writer{w: w}
+
+	// BOM
+	wr.pr("\xef\xbb\xbf")
+
+	// Script Info section
+	wr.prn("[Script Info]") // This must be the first line
+	wr.prn("; Script generated by Srtgears")
+	wr.prn("; ", HomePage)
+	wr.prn("Title: ")
+	wr.prn("ScriptType: v4.00+")
+	wr.prn("WrapStyle: 0")
+	wr.prn("ScaledBorderAndShadow: yes")
+	wr.prn("Collisions: Normal")
+	wr.prn("PlayResX: 800")
+	wr.prn("PlayResY: 600")
+
+	// Styles section
+	wr.prn()
+	wr.prn("[V4+ Styles]")
+	wr.prn("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding")
+	styleKeys, stylesMap, styles := collectStyles(sp, modelPosToAssPos)
+	// Now generate style definitions. Colors are in &HAABBGGRR format, alpha 00 is opaque.
+	for _, v := range styles {
+		wr.prf("Style: %s,Arial,28,&H00%06X,&H000000FF,&H00000000,&H80000000,-1,0,0,0,100,100,0,0,1,1,2,%d,30,30,30,1",
+			stylesMap[v], v.Color, v.Pos)
+		wr.prn()
+	}
+
+	// Events section
+	wr.prn()
+	wr.prn("[Events]")
+	wr.prn("Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text")
+
+	for i, s := range sp.Subs {
+		if wr.err != nil {
+			break
+		}
+
+		wr.pr("Dialogue: 0,")
+		prSsaTime(wr, s.TimeIn)
+		wr.pr(",")
+		prSsaTime(wr, s.TimeOut)
+		wr.pr(",", stylesMap[styleKeys[i]], ",,0,0,0,,")
+
+		// Texts
+		for i, line := range s.Lines {
+			// Note: HTML and controls not need to be removed (they are handled by video players)
+			wr.pr(line)
+			if i != len(s.Lines)-1 {
+				wr.pr(`\N`)
+			}
+		}
+		wr.prn()
+	}
+
+	return wr.err
+}
@@ -0,0 +1,292 @@
+/*
+
+This file implements automatic alignment of subtitles to a reference subtitle track
+(e.g. a badly timed translation to a correctly timed original), purely from the timing structure.
+
+Both subtitle tracks are viewed as on/off signals (subtitle displayed or not). The alignment
+maximizes the overlap of the 2 signals (the cross-correlation of the on/off signals):
+ - first a global linear mapping (scale and offset) is searched; scale candidates are 1 and the
+   ratios of common frame rates, the offset is searched coarse-to-fine within a max offset;
+ - optionally the mapping is refined piecewise: the reference timeline is cut into segments,
+   and the best local offset of each segment is searched, resulting in sync points.
+
+The confidence tells how much better the found alignment is compared to a random alignment:
+0 means no better, 1 means perfect match.
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// AlignOptions controls aligning.
+type AlignOptions struct {
+	MaxOffset time.Duration // Max (absolute) offset to search
+	Scales    []float64     // Scale candidates to try
+
+	// Piecewise tells to refine the global mapping piecewise, resulting in sync points.
+	Piecewise     bool
+	SegmentLen    time.Duration // Length of segments of the reference timeline (when Piecewise)
+	MaxLocalShift time.Duration // Max (absolute) local offset of segments relative to the global mapping (when Piecewise)
+}
+
+// DefaultAlignOptions returns the default align options.
+func DefaultAlignOptions() *AlignOptions {
+	return &AlignOptions{
+		MaxOffset: 10 * time.Minute,
+		Scales: []float64{1,
+			25 / 23.976, 23.976 / 25, // PAL speedup
+			25.0 / 24, 24.0 / 25,
+			1.001, 1 / 1.001, // NTSC
+		},
+		Piecewise:     true,
+		SegmentLen:    5 * time.Minute,
+		MaxLocalShift: 2 * time.Minute,
+	}
+}
+
+// AlignResult is the result of aligning.
+type AlignResult struct {
+	// Global linear mapping: t' = t*Scale + Offset
+	Scale  float64
+	Offset time.Duration
+
+	// Points is the piecewise mapping (applied with ExtrapolateLinear) if it was computed
+	// and is better than the global mapping, nil otherwise.
+	Points []SyncPoint
+
+	// Confidence of the alignment, from 0 (no better than random) to 1 (perfect match).
+	Confidence float64
+}
+
+// String returns a human readable description of the result.
+func (ar *AlignResult) String() string {
+	return fmt.Sprintf("scale: %.5f, offset: %v, sync points: %d, confidence: %.1f%%",
+		ar.Scale, ar.Offset, len(ar.Points), ar.Confidence*100)
+}
+
+// interval is a time interval during which subtitle is displayed.
+type interval struct {
+	from, to time.Duration
+}
+
+// intervals returns the sorted, non-overlapping intervals during which subtitles are displayed.
+func (sp *SubsPack) intervals() (ivs []interval) {
+	for _, s := range sp.Subs {
+		if s.TimeOut > s.TimeIn {
+			ivs = append(ivs, interval{s.TimeIn, s.TimeOut})
+		}
+	}
+	sort.Slice(ivs, func(i, j int) bool { return ivs[i].from < ivs[j].from })
+
+	// Merge overlapping intervals
+	merged := ivs[:0]
+	for _, iv := range ivs {
+		if n := len(merged); n > 0 && iv.from <= merged[n-1].to {
+			if iv.to > merged[n-1].to {
+				merged[n-1].to = iv.to
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// totalLen returns the total length of the intervals.
+func totalLen(ivs []interval) (total time.Duration) {
+	for _, iv := range ivs {
+		total += iv.to - iv.from
+	}
+	return
+}
+
+// overlap returns the total overlap of intervals a mapped by scale and offset, and intervals b.
+func overlap(a, b []interval, scale float64, offset time.Duration) (total time.Duration) {
+	m := func(t time.Duration) time.Duration {
+		return time.Duration(float64(t)*scale) + offset
+	}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		from, to := m(a[i].from), m(a[i].to)
+		if from < b[j].from {
+			from = b[j].from
+		}
+		end := b[j].to
+		if to < end {
+			end = to
+		}
+		if end > from {
+			total += end - from
+		}
+		if to < b[j].to {
+			i++
+		} else {
+			j++
+		}
+	}
+	return
+}
+
+// bestOffset searches the offset in the range [lo, hi] which maximizes the overlap,
+// coarse-to-fine down to millisecond precision.
+func bestOffset(a, b []interval, scale float64, lo, hi time.Duration) (best, bestOverlap time.Duration) {
+	best, bestOverlap = lo, -1
+	for step := 250 * time.Millisecond; ; step /= 5 {
+		if step < time.Millisecond {
+			step = time.Millisecond
+		}
+		for offset := lo; offset <= hi; offset += step {
+			if ov := overlap(a, b, scale, offset); ov > bestOverlap {
+				best, bestOverlap = offset, ov
+			}
+		}
+		if step == time.Millisecond {
+			break
+		}
+		lo, hi = best-step, best+step
+	}
+	return
+}
+
+// confidence returns the confidence of an alignment having the given overlap
+// of signals a and b having the given total lengths, spanning the given length.
+func confidence(ov, lenA, lenB, span time.Duration) float64 {
+	minLen, maxLen := lenA, lenB
+	if minLen > maxLen {
+		minLen, maxLen = maxLen, minLen
+	}
+	if minLen <= 0 || span <= 0 {
+		return 0
+	}
+	coverage := float64(ov) / float64(minLen)
+	random := float64(maxLen) / float64(span) // Expected coverage of a random alignment
+	if random >= 1 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, (coverage-random)/(1-random)))
+}
+
+// Align estimates the mapping which aligns the subtitles to the reference subtitles, based on timing structure only.
+// The subtitles are not modified, see SyncTo(). If opts is nil, DefaultAlignOptions() is used.
+func (sp *SubsPack) Align(ref *SubsPack, opts *AlignOptions) (*AlignResult, error) {
+	if opts == nil {
+		opts = DefaultAlignOptions()
+	}
+	a, b := sp.intervals(), ref.intervals()
+	if len(a) == 0 || len(b) == 0 {
+		return nil, fmt.Errorf("No subtitles to align")
+	}
+	scales := opts.Scales
+	if len(scales) == 0 {
+		scales = []float64{1}
+	}
+
+	// Global mapping
+	ar := &AlignResult{}
+	bestOverlap := time.Duration(-1)
+	for _, scale := range scales {
+		offset, ov := bestOffset(a, b, scale, -opts.MaxOffset, opts.MaxOffset)
+		if ov > bestOverlap {
+			ar.Scale, ar.Offset, bestOverlap = scale, offset, ov
+		}
+	}
+
+	global := func(t time.Duration) time.Duration {
+		return time.Duration(float64(t)*ar.Scale) + ar.Offset
+	}
+	// conf returns the confidence of the overlap of intervals a mapped by f and the reference intervals.
+	conf := func(f func(t time.Duration) time.Duration) float64 {
+		mapped := make([]interval, len(a))
+		for i, iv := range a {
+			mapped[i] = interval{f(iv.from), f(iv.to)}
+		}
+		from, to := mapped[0].from, mapped[len(mapped)-1].to
+		if b[0].from < from {
+			from = b[0].from
+		}
+		if b[len(b)-1].to > to {
+			to = b[len(b)-1].to
+		}
+		return confidence(overlap(mapped, b, 1, 0), totalLen(mapped), totalLen(b), to-from)
+	}
+	ar.Confidence = conf(global)
+
+	if !opts.Piecewise || opts.SegmentLen <= 0 {
+		return ar, nil
+	}
+
+	// Piecewise refinement: local offset of segments of the reference timeline
+	mapped := make([]interval, len(a))
+	for i, iv := range a {
+		mapped[i] = interval{global(iv.from), global(iv.to)}
+	}
+	for i := 0; i < len(b); {
+		// Reference intervals of the segment
+		segFrom := b[i].from
+		j := i + sort.Search(len(b)-i, func(j int) bool { return b[i+j].from >= segFrom+opts.SegmentLen })
+		segB := b[i:j]
+		i = j
+		segTo := segB[len(segB)-1].to
+
+		// Mapped intervals that may match the segment
+		k := sort.Search(len(mapped), func(k int) bool { return mapped[k].to > segFrom-opts.MaxLocalShift })
+		l := sort.Search(len(mapped), func(l int) bool { return mapped[l].from >= segTo+opts.MaxLocalShift })
+		if k >= l {
+			continue
+		}
+
+		shift, ov := bestOffset(mapped[k:l], segB, 1, -opts.MaxLocalShift, opts.MaxLocalShift)
+		if ov <= 0 {
+			continue
+		}
+
+		// Sync point at the center of the segment, From in original time
+		center := (segFrom + segTo) / 2
+		from := time.Duration(float64(center-shift-ar.Offset) / ar.Scale)
+		if n := len(ar.Points); n > 0 && (from <= ar.Points[n-1].From || center <= ar.Points[n-1].To) {
+			continue // Would break monotonicity
+		}
+		ar.Points = append(ar.Points, SyncPoint{From: from, To: center})
+	}
+
+	if len(ar.Points) > 0 {
+		f, err := syncPointsMap(ar.Points, ExtrapolateLinear)
+		if err != nil {
+			return nil, err
+		}
+		if c := conf(f); c > ar.Confidence {
+			ar.Confidence = c
+		} else {
+			ar.Points = nil // Piecewise mapping is not better than the global one
+		}
+	}
+	return ar, nil
+}
+
+// SyncTo aligns the subtitles to the reference subtitles (see Align()), and applies the estimated mapping.
+// If opts is nil, DefaultAlignOptions() is used.
+func (sp *SubsPack) SyncTo(ref *SubsPack, opts *AlignOptions) (*AlignResult, error) {
+	ar, err := sp.Align(ref, opts)
+	if err != nil {
+		return nil, err
+	}
+	return ar, sp.ApplyAlign(ar)
+}
+
+// ApplyAlign applies the mapping estimated by Align().
+func (sp *SubsPack) ApplyAlign(ar *AlignResult) error {
+	if len(ar.Points) > 0 {
+		return sp.SyncPoints(ar.Points, ExtrapolateLinear)
+	}
+	for _, s := range sp.Subs {
+		s.mapTimes(func(t time.Duration) time.Duration {
+			return time.Duration(float64(t)*ar.Scale) + ar.Offset
+		})
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+
+Package audiosync synchronizes subtitles to the soundtrack of a movie, for cases where no reference subtitle exists.
+
+The soundtrack must be provided as a PCM WAV file (e.g. extracted from the movie with ffmpeg:
+"ffmpeg -i movie.mkv -vn -ac 1 -ar 16000 movie.wav").
+
+A simple energy based voice activity detector (VAD) finds the speech intervals of the soundtrack:
+frames louder than the noise floor by a threshold are considered speech, short pauses are bridged
+and short noises are dropped. Then the offset and scale are searched which best match the subtitle
+intervals to the speech intervals (see srtgears.SubsPack.Align()), and they are applied using the
+Scale() and Rebase() methods of the subtitles (subtitles shifted to end before 0 are removed).
+
+*/
+package audiosync
+
+import (
+	"fmt"
+	"github.com/icza/srtgears"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Options controls voice activity detection and syncing.
+type Options struct {
+	FrameLen    time.Duration // Length of frames of which energy is measured
+	ThresholdDB float64       // Frames louder than the noise floor by this are speech, in dB
+	MinSpeech   time.Duration // Shorter speech intervals are dropped
+	MinSilence  time.Duration // Shorter silences between speech intervals are bridged
+
+	MaxOffset time.Duration // Max (absolute) offset to search
+	Scales    []float64     // Scale candidates to try
+}
+
+// DefaultOptions returns the default options.
+func DefaultOptions() *Options {
+	return &Options{
+		FrameLen:    20 * time.Millisecond,
+		ThresholdDB: 12,
+		MinSpeech:   200 * time.Millisecond,
+		MinSilence:  300 * time.Millisecond,
+		MaxOffset:   srtgears.DefaultAlignOptions().MaxOffset,
+		Scales:      srtgears.DefaultAlignOptions().Scales,
+	}
+}
+
+// Interval is a time interval.
+type Interval struct {
+	From, To time.Duration
+}
+
+// Energy below this is treated as digital silence, excluded from the noise floor estimation.
+const silenceEnergy = 1e-6
+
+// DetectVoice detects speech intervals from frame energies (see ReadEnergy()).
+func DetectVoice(energy []float64, opts *Options) (speech []Interval) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	// Noise floor: 10th percentile of the (non-silent) frame levels
+	var levels []float64
+	for _, e := range energy {
+		if e > silenceEnergy {
+			levels = append(levels, 20*math.Log10(e))
+		}
+	}
+	if len(levels) == 0 {
+		return nil
+	}
+	sort.Float64s(levels)
+	threshold := levels[len(levels)/10] + opts.ThresholdDB
+
+	frameTime := func(i int) time.Duration {
+		return time.Duration(i) * opts.FrameLen
+	}
+
+	start := -1 // Start frame of the current speech interval
+	for i := 0; i <= len(energy); i++ {
+		loud := i < len(energy) && energy[i] > silenceEnergy && 20*math.Log10(energy[i]) >= threshold
+		switch {
+		case loud && start < 0:
+			start = i
+		case !loud && start >= 0:
+			iv := Interval{frameTime(start), frameTime(i)}
+			if n := len(speech); n > 0 && iv.From-speech[n-1].To < opts.MinSilence {
+				speech[n-1].To = iv.To // Bridge short silence
+			} else {
+				speech = append(speech, iv)
+			}
+			start = -1
+		}
+	}
+
+	// Drop short noises
+	kept := speech[:0]
+	for _, iv := range speech {
+		if iv.To-iv.From >= opts.MinSpeech {
+			kept = append(kept, iv)
+		}
+	}
+	return kept
+}
+
+// Sync reads the soundtrack from a PCM WAV, detects speech intervals, finds the offset and scale
+// that best match the subtitles to them, and applies them to the subtitles.
+// Subtitles shifted to end before 0 are removed.
+// If opts is nil, DefaultOptions() is used.
+func Sync(sp *srtgears.SubsPack, wav io.Reader, opts *Options) (*srtgears.AlignResult, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	energy, _, err := ReadEnergy(wav, opts.FrameLen)
+	if err != nil {
+		return nil, err
+	}
+	speech := DetectVoice(energy, opts)
+	if len(speech) == 0 {
+		return nil, fmt.Errorf("No speech detected in the audio")
+	}
+
+	// Speech intervals as reference subtitles
+	ref := &srtgears.SubsPack{}
+	for _, iv := range speech {
+		ref.Subs = append(ref.Subs, &srtgears.Subtitle{TimeIn: iv.From, TimeOut: iv.To})
+	}
+
+	ar, err := sp.Align(ref, &srtgears.AlignOptions{MaxOffset: opts.MaxOffset, Scales: opts.Scales})
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.Scale != 1 {
+		sp.Scale(ar.Scale)
+	}
+	// Shifting back may move subtitles before 0: drop the ones ending before it, clamp the rest
+	sp.Rebase(-ar.Offset.Round(time.Millisecond))
+	return ar, nil
+}
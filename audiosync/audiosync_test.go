@@ -0,0 +1,97 @@
+package audiosync
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/icza/srtgears"
+)
+
+// levels returns frame energies: pairs of frame count and energy.
+func levels(pairs ...float64) (energy []float64) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		for j := 0; j < int(pairs[i]); j++ {
+			energy = append(energy, pairs[i+1])
+		}
+	}
+	return
+}
+
+func TestDetectVoice(t *testing.T) {
+	const noise, tone = 0.001, 0.5
+	ms := time.Millisecond
+	// Default options: frames of 20ms, min speech 200ms, min silence 300ms
+	cases := []struct {
+		name   string
+		energy []float64
+		exp    []Interval
+	}{
+		{"tone", levels(50, noise, 50, tone, 50, noise),
+			[]Interval{{1000 * ms, 2000 * ms}}},
+		{"short pause bridged", levels(50, noise, 50, tone, 10, noise, 50, tone, 50, noise),
+			[]Interval{{1000 * ms, 3200 * ms}}},
+		{"long pause", levels(50, noise, 50, tone, 20, noise, 50, tone, 50, noise),
+			[]Interval{{1000 * ms, 2000 * ms}, {2400 * ms, 3400 * ms}}},
+		{"short noise dropped", levels(50, noise, 5, tone, 50, noise, 50, tone, 50, noise),
+			[]Interval{{2100 * ms, 3100 * ms}}},
+		{"speech till the end", levels(50, noise, 50, tone),
+			[]Interval{{1000 * ms, 2000 * ms}}},
+		{"digital silence", levels(50, 0, 50, tone, 50, 0, 50, noise),
+			[]Interval{{1000 * ms, 2000 * ms}}},
+		{"only silence", levels(100, 0),
+			nil},
+		{"only noise", levels(100, noise),
+			nil},
+	}
+	for _, c := range cases {
+		if got := DetectVoice(c.energy, nil); len(got) != len(c.exp) || len(got) > 0 && !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, got)
+		}
+	}
+}
+
+// soundtrack returns a 16-bit mono WAV file at 8000 samples per second: noise with a tone in the given intervals.
+func soundtrack(length time.Duration, speech []Interval) []byte {
+	const rate = 8000
+	vs := square(int(length.Seconds()*rate), 30) // Noise
+	for _, iv := range speech {
+		for i := int(iv.From.Seconds() * rate); i < int(iv.To.Seconds()*rate); i++ {
+			vs[i] *= 500
+		}
+	}
+	return wav(fmtChunk(wavFormatPCM, 1, rate, 16), chunk("data", samples(16, vs...)))
+}
+
+func TestSync(t *testing.T) {
+	s := time.Second
+	speech := []Interval{{1 * s, 2 * s}, {4 * s, 5500 * time.Millisecond}, {7 * s, 8 * s}, {9 * s, 11 * s}, {13 * s, 15 * s}}
+	sp := &srtgears.SubsPack{}
+	for _, iv := range speech {
+		// Subtitles are 1.5s late
+		sp.Subs = append(sp.Subs, &srtgears.Subtitle{TimeIn: iv.From + 1500*time.Millisecond, TimeOut: iv.To + 1500*time.Millisecond, Lines: []string{"x"}})
+	}
+	// A subtitle ending before 0 after the shift is removed
+	sp.Subs = append([]*srtgears.Subtitle{{TimeIn: 0, TimeOut: time.Second, Lines: []string{"x"}}}, sp.Subs...)
+
+	ar, err := Sync(sp, bytes.NewReader(soundtrack(16*s, speech)), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ar.Offset != -1500*time.Millisecond || ar.Scale != 1 {
+		t.Errorf("Expected offset and scale: %v, %v, got: %v, %v", -1500*time.Millisecond, 1, ar.Offset, ar.Scale)
+	}
+	if len(sp.Subs) != len(speech) {
+		t.Fatalf("Expected subtitles: %d, got: %d", len(speech), len(sp.Subs))
+	}
+	for i, sub := range sp.Subs {
+		if sub.TimeIn != speech[i].From || sub.TimeOut != speech[i].To {
+			t.Errorf("Expected: %v, got: %v-%v", speech[i], sub.TimeIn, sub.TimeOut)
+		}
+	}
+
+	if _, err := Sync(sp, bytes.NewReader(soundtrack(16*s, nil)), nil); err == nil {
+		t.Errorf("Expected error for no speech")
+	}
+}
@@ -0,0 +1,175 @@
+/*
+
+This file implements reading PCM WAV files.
+
+Only the frame energies are computed while reading (the samples are not kept in memory),
+so even the soundtrack of a whole movie can be processed.
+
+Supported formats: integer PCM of 8, 16, 24 and 32 bits, and IEEE float of 32 bits
+(also in the WAVE_FORMAT_EXTENSIBLE container), any number of channels (channels are mixed down).
+
+*/
+
+package audiosync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// WAV format codes.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// Limits of WAV formats accepted, so malformed files can't make us allocate huge buffers.
+const (
+	wavMaxFmtSize    = 1024   // Max size of the format chunk
+	wavMaxChannels   = 64     // Max number of channels
+	wavMaxSampleRate = 768000 // Max samples per second
+)
+
+// WAVInfo describes the format of a WAV file.
+type WAVInfo struct {
+	Channels      int // Number of channels
+	SampleRate    int // Samples per second (per channel)
+	BitsPerSample int // Bits per sample
+	Float         bool
+}
+
+// ReadEnergy reads a PCM WAV file and returns the energy (RMS of the samples normalized to [-1..1],
+// channels mixed down) of its frames having the given length.
+func ReadEnergy(r io.Reader, frameLen time.Duration) (energy []float64, info *WAVInfo, err error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	var hdr [12]byte
+	if _, err = io.ReadFull(br, hdr[:]); err != nil {
+		return nil, nil, fmt.Errorf("Invalid WAV header: %v", err)
+	}
+	if string(hdr[:4]) != "RIFF" || string(hdr[8:]) != "WAVE" {
+		return nil, nil, errors.New("Not a WAV file")
+	}
+
+	// Chunks
+	for {
+		var chdr [8]byte
+		if _, err = io.ReadFull(br, chdr[:]); err != nil {
+			return nil, nil, fmt.Errorf("Missing WAV data: %v", err)
+		}
+		id, size := string(chdr[:4]), int64(binary.LittleEndian.Uint32(chdr[4:]))
+
+		switch id {
+		case "fmt ":
+			if info, err = readFmt(br, size); err != nil {
+				return nil, nil, err
+			}
+		case "data":
+			if info == nil {
+				return nil, nil, errors.New("Missing WAV format chunk")
+			}
+			var data io.Reader = br
+			if size > 0 && size != 0xffffffff { // 0 and max size are used when streaming: read until EOF
+				data = io.LimitReader(br, size)
+			}
+			energy, err = readEnergy(data, info, frameLen)
+			return
+		default:
+			if _, err = io.CopyN(io.Discard, br, size+size%2); err != nil { // Chunks are padded to even size
+				return nil, nil, fmt.Errorf("Invalid WAV chunk %q: %v", id, err)
+			}
+		}
+	}
+}
+
+// readFmt reads the format chunk of a WAV file.
+func readFmt(r io.Reader, size int64) (*WAVInfo, error) {
+	if size < 16 || size > wavMaxFmtSize {
+		return nil, fmt.Errorf("Invalid WAV format chunk size: %d", size)
+	}
+	buf := make([]byte, size+size%2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("Invalid WAV format chunk: %v", err)
+	}
+
+	format := binary.LittleEndian.Uint16(buf)
+	if format == wavFormatExtensible && size >= 26 {
+		format = binary.LittleEndian.Uint16(buf[24:]) // First 2 bytes of the sub-format GUID
+	}
+	info := &WAVInfo{
+		Channels:      int(binary.LittleEndian.Uint16(buf[2:])),
+		SampleRate:    int(binary.LittleEndian.Uint32(buf[4:])),
+		BitsPerSample: int(binary.LittleEndian.Uint16(buf[14:])),
+		Float:         format == wavFormatFloat,
+	}
+
+	switch {
+	case format != wavFormatPCM && format != wavFormatFloat:
+		return nil, fmt.Errorf("Unsupported WAV format: %d (only PCM is supported)", format)
+	case info.Float && info.BitsPerSample != 32,
+		!info.Float && (info.BitsPerSample%8 != 0 || info.BitsPerSample < 8 || info.BitsPerSample > 32):
+		return nil, fmt.Errorf("Unsupported WAV bits per sample: %d", info.BitsPerSample)
+	case info.Channels < 1 || info.Channels > wavMaxChannels || info.SampleRate < 1 || info.SampleRate > wavMaxSampleRate:
+		return nil, fmt.Errorf("Invalid WAV channels or sample rate: %d, %d", info.Channels, info.SampleRate)
+	}
+	return info, nil
+}
+
+// readEnergy reads the samples and computes the energy of frames.
+func readEnergy(r io.Reader, info *WAVInfo, frameLen time.Duration) (energy []float64, err error) {
+	bytesPerSample := info.BitsPerSample / 8
+	blockSize := bytesPerSample * info.Channels // Size of samples of all channels
+	frameSamples := int(math.Round(frameLen.Seconds() * float64(info.SampleRate)))
+	if frameSamples < 1 {
+		frameSamples = 1
+	}
+
+	// sample returns the sample at the beginning of b, normalized to [-1..1].
+	var sample func(b []byte) float64
+	switch {
+	case info.Float:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case bytesPerSample == 1: // 8-bit is unsigned
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	default:
+		scale := float64(int64(1) << (info.BitsPerSample - 1))
+		shift := uint(32 - info.BitsPerSample)
+		sample = func(b []byte) float64 {
+			var v uint32
+			for i := bytesPerSample - 1; i >= 0; i-- {
+				v = v<<8 | uint32(b[i])
+			}
+			return float64(int32(v<<shift)>>shift) / scale // Sign extension
+		}
+	}
+
+	buf := make([]byte, blockSize*frameSamples)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n >= blockSize {
+			var sum float64
+			blocks := n / blockSize
+			for i := 0; i < blocks; i++ {
+				var mix float64
+				for ch := 0; ch < info.Channels; ch++ {
+					mix += sample(buf[i*blockSize+ch*bytesPerSample:])
+				}
+				mix /= float64(info.Channels)
+				sum += mix * mix
+			}
+			energy = append(energy, math.Sqrt(sum/float64(blocks)))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return energy, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
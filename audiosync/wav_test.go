@@ -0,0 +1,192 @@
+package audiosync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunk returns a WAV chunk, padded to even size.
+func chunk(id string, data []byte) []byte {
+	b := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// fmtChunk returns a format chunk.
+func fmtChunk(format, channels, sampleRate, bits int) []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b, uint16(format))
+	binary.LittleEndian.PutUint16(b[2:], uint16(channels))
+	binary.LittleEndian.PutUint32(b[4:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(b[8:], uint32(sampleRate*channels*bits/8))
+	binary.LittleEndian.PutUint16(b[12:], uint16(channels*bits/8))
+	binary.LittleEndian.PutUint16(b[14:], uint16(bits))
+	return chunk("fmt ", b)
+}
+
+// extensibleFmtChunk returns a WAVE_FORMAT_EXTENSIBLE format chunk of the given sub-format.
+func extensibleFmtChunk(subFormat, channels, sampleRate, bits int) []byte {
+	b := fmtChunk(wavFormatExtensible, channels, sampleRate, bits)[8:]
+	ext := make([]byte, 24)
+	binary.LittleEndian.PutUint16(ext, 22) // Size of the extension
+	binary.LittleEndian.PutUint16(ext[2:], uint16(bits))
+	binary.LittleEndian.PutUint16(ext[8:], uint16(subFormat))
+	return chunk("fmt ", append(b, ext...))
+}
+
+// wav returns a WAV file of the chunks.
+func wav(chunks ...[]byte) []byte {
+	b := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+// samples encodes the samples (integers of the given bits, little endian; 8-bit is unsigned).
+func samples(bits int, values ...int32) (b []byte) {
+	for _, v := range values {
+		if bits == 8 {
+			v += 128
+		}
+		for i := 0; i < bits/8; i++ {
+			b = append(b, byte(v>>(8*i)))
+		}
+	}
+	return
+}
+
+// floats encodes 32-bit float samples.
+func floats(values ...float32) (b []byte) {
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return
+}
+
+// square returns n samples of a square wave of amplitude a (RMS is a).
+func square(n int, a int32) []int32 {
+	vs := make([]int32, n)
+	for i := range vs {
+		vs[i] = a
+		if i%2 == 1 {
+			vs[i] = -a
+		}
+	}
+	return vs
+}
+
+func TestReadEnergy(t *testing.T) {
+	// At 1000 samples per second, frames of 10ms have 10 samples
+	cases := []struct {
+		name string
+		data []byte
+		exp  []float64
+	}{
+		{"8-bit", wav(fmtChunk(wavFormatPCM, 1, 1000, 8), chunk("data", samples(8, square(20, 64)...))),
+			[]float64{0.5, 0.5}},
+		{"16-bit", wav(fmtChunk(wavFormatPCM, 1, 1000, 16), chunk("data", samples(16, append(square(10, 1<<14), square(10, 1<<13)...)...))),
+			[]float64{0.5, 0.25}},
+		{"24-bit", wav(fmtChunk(wavFormatPCM, 1, 1000, 24), chunk("data", samples(24, square(10, 1<<22)...))),
+			[]float64{0.5}},
+		{"32-bit", wav(fmtChunk(wavFormatPCM, 1, 1000, 32), chunk("data", samples(32, square(10, 1<<30)...))),
+			[]float64{0.5}},
+		{"float", wav(fmtChunk(wavFormatFloat, 1, 1000, 32), chunk("data", floats(0.5, -0.5, 0.5, -0.5, 0.5, -0.5, 0.5, -0.5, 0.5, -0.5))),
+			[]float64{0.5}},
+		{"extensible PCM", wav(extensibleFmtChunk(wavFormatPCM, 1, 1000, 16), chunk("data", samples(16, square(10, 1<<14)...))),
+			[]float64{0.5}},
+		{"extensible float", wav(extensibleFmtChunk(wavFormatFloat, 1, 1000, 32), chunk("data", floats(0.25, -0.25, 0.25, -0.25, 0.25, -0.25, 0.25, -0.25, 0.25, -0.25))),
+			[]float64{0.25}},
+		{"stereo mixed down", wav(fmtChunk(wavFormatPCM, 2, 1000, 16), chunk("data", samples(16, 1<<14, 1<<14, -1<<14, 0, 1<<14, -1<<14, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0))),
+			[]float64{math.Sqrt((0.25 + 0.0625) / 10)}},
+		{"odd-sized chunk before data", wav(fmtChunk(wavFormatPCM, 1, 1000, 16), chunk("LIST", []byte("abc")), chunk("data", samples(16, square(10, 1<<14)...))),
+			[]float64{0.5}},
+		{"chunk before format", wav(chunk("JUNK", make([]byte, 5)), fmtChunk(wavFormatPCM, 1, 1000, 16), chunk("data", samples(16, square(10, 1<<14)...))),
+			[]float64{0.5}},
+		{"partial last frame", wav(fmtChunk(wavFormatPCM, 1, 1000, 16), chunk("data", samples(16, square(14, 1<<14)...))),
+			[]float64{0.5, 0.5}},
+		{"odd-sized data", wav(fmtChunk(wavFormatPCM, 1, 1000, 16), chunk("data", append(samples(16, square(10, 1<<14)...), 1))),
+			[]float64{0.5}},
+		{"data size of streaming", append(wav(fmtChunk(wavFormatPCM, 1, 1000, 16), []byte("data\x00\x00\x00\x00")), samples(16, square(10, 1<<14)...)...),
+			[]float64{0.5}},
+		{"data size more than data", append(wav(fmtChunk(wavFormatPCM, 1, 1000, 16), []byte("data\x00\x10\x00\x00")), samples(16, square(10, 1<<14)...)...),
+			[]float64{0.5}},
+		{"no samples", wav(fmtChunk(wavFormatPCM, 1, 1000, 16), chunk("data", nil)),
+			nil},
+	}
+	for _, c := range cases {
+		energy, _, err := ReadEnergy(bytes.NewReader(c.data), 10*time.Millisecond)
+		if err != nil {
+			t.Errorf("[%s] Unexpected error: %v", c.name, err)
+			continue
+		}
+		if len(energy) != len(c.exp) {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, energy)
+			continue
+		}
+		for i, e := range energy {
+			if math.Abs(e-c.exp[i]) > 1e-9 {
+				t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, energy)
+				break
+			}
+		}
+	}
+}
+
+func TestReadEnergyInfo(t *testing.T) {
+	data := wav(extensibleFmtChunk(wavFormatFloat, 2, 48000, 32), chunk("data", nil))
+	_, info, err := ReadEnergy(bytes.NewReader(data), 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exp := (WAVInfo{Channels: 2, SampleRate: 48000, BitsPerSample: 32, Float: true}); *info != exp {
+		t.Errorf("Expected: %+v, got: %+v", exp, *info)
+	}
+}
+
+func TestReadEnergyInvalid(t *testing.T) {
+	pcm := fmtChunk(wavFormatPCM, 1, 1000, 16)
+	data := chunk("data", samples(16, square(10, 1<<14)...))
+	cases := []struct {
+		name   string
+		data   []byte
+		expErr string // Expected prefix of the error
+	}{
+		{"empty", nil, "Invalid WAV header"},
+		{"truncated header", []byte("RIFF\x00\x00"), "Invalid WAV header"},
+		{"not RIFF", []byte("RIFX\x00\x00\x00\x00WAVE"), "Not a WAV file"},
+		{"not WAVE", []byte("RIFF\x00\x00\x00\x00AVI "), "Not a WAV file"},
+		{"no chunks", wav(), "Missing WAV data"},
+		{"no data chunk", wav(pcm), "Missing WAV data"},
+		{"truncated chunk header", append(wav(pcm), "da"...), "Missing WAV data"},
+		{"data before format", wav(data, pcm), "Missing WAV format chunk"},
+		{"truncated chunk", wav(pcm, []byte("LIST\x10\x00\x00\x00abc")), `Invalid WAV chunk "LIST"`},
+		{"short format", wav(chunk("fmt ", make([]byte, 14)), data), "Invalid WAV format chunk size"},
+		{"huge format", wav([]byte("fmt \xff\xff\xff\xff"), data), "Invalid WAV format chunk size"},
+		{"truncated format", wav(pcm[:20]), "Invalid WAV format chunk"},
+		{"ADPCM", wav(fmtChunk(2, 1, 1000, 4), data), "Unsupported WAV format"},
+		{"extensible ADPCM", wav(extensibleFmtChunk(2, 1, 1000, 4), data), "Unsupported WAV format"},
+		{"12-bit", wav(fmtChunk(wavFormatPCM, 1, 1000, 12), data), "Unsupported WAV bits per sample"},
+		{"40-bit", wav(fmtChunk(wavFormatPCM, 1, 1000, 40), data), "Unsupported WAV bits per sample"},
+		{"64-bit float", wav(fmtChunk(wavFormatFloat, 1, 1000, 64), data), "Unsupported WAV bits per sample"},
+		{"no channels", wav(fmtChunk(wavFormatPCM, 0, 1000, 16), data), "Invalid WAV channels or sample rate"},
+		{"too many channels", wav(fmtChunk(wavFormatPCM, 0xffff, 1000, 16), data), "Invalid WAV channels or sample rate"},
+		{"no sample rate", wav(fmtChunk(wavFormatPCM, 1, 0, 16), data), "Invalid WAV channels or sample rate"},
+		{"huge sample rate", wav(fmtChunk(wavFormatPCM, 1, math.MaxInt32, 16), data), "Invalid WAV channels or sample rate"},
+	}
+	for _, c := range cases {
+		_, _, err := ReadEnergy(bytes.NewReader(c.data), 10*time.Millisecond)
+		if err == nil || !strings.HasPrefix(err.Error(), c.expErr) {
+			t.Errorf("[%s] Expected error: %s, got: %v", c.name, c.expErr, err)
+		}
+	}
+}
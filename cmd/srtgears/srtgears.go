@@ -6,12 +6,13 @@ This is the main package of the Srtgears command line tool.
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/icza/srtgears"
 	"github.com/icza/srtgears/exec"
+	"log"
 	"os"
 	"path"
-	"strings"
 )
 
 // Version is the Srtgears version, filled by build
@@ -26,7 +27,7 @@ func main() {
 	e.FlagSet.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of srtgears:\n")
 		e.FlagSet.PrintDefaults()
-		fmt.Println(examples)
+		fmt.Printf("%s\n", examples)
 	}
 
 	if err := e.ProcFlags(os.Args[1:]); err != nil {
@@ -42,9 +43,33 @@ func main() {
 		return
 	}
 
-	if err := e.GearIt(); err != nil {
+	if e.SyncAudio != "" {
+		f, err := os.Open(e.SyncAudio)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer f.Close()
+		debugf("Reading audio from file: %s", e.SyncAudio)
+		e.Audio = f
+	}
+
+	err := e.GearIt()
+	if e.SyncResult != nil {
+		debugf("Synced: %v", e.SyncResult)
+	}
+	for _, o := range e.OverlapsFound {
+		debugf("Resolved overlap: %v", o)
+	}
+	if e.ShortMerged > 0 {
+		debugf("Merged short subtitles: %d", e.ShortMerged)
+	}
+	if e.LongSplit > 0 {
+		debugf("Split long subtitles: %d", e.LongSplit)
+	}
+	if err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
 
 	if e.Stats {
@@ -57,49 +82,97 @@ func main() {
 	}
 }
 
-// readFiles loads the subtitle files specified by the '-in' and '-in2' flags.
+// readFiles loads the subtitle files specified by the '-in', '-in2' and '-syncTo' flags,
+// and the sync points file specified by the '-syncPoints' flag.
 func readFiles() (err error) {
+	inEnc, _, err := e.Encodings()
+	if err != nil {
+		return
+	}
+
+	rf := func(name string) (*srtgears.SubsPack, error) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		data, enc := srtgears.ToUTF8(data, inEnc)
+		debugf("Encoding of %s: %s", name, enc)
+		f := srtgears.DetectFormat(name, data)
+		if f == nil {
+			return nil, fmt.Errorf("Unsupported input format, only %s are supported: %s", exec.ExtList(), name)
+		}
+		debugf("Reading from file: %s (%s)", name, f.Name())
+		return e.ConfigFormat(f, false).Read(bytes.NewReader(data))
+	}
+
 	if e.In != "" {
-		if e.Sp1, err = srtgears.ReadSrtFile(e.In); err != nil {
+		if e.Sp1, err = rf(e.In); err != nil {
 			return
 		}
 	}
 	if e.In2 != "" {
-		if e.Sp2, err = srtgears.ReadSrtFile(e.In2); err != nil {
+		if e.Sp2, err = rf(e.In2); err != nil {
+			return
+		}
+	}
+	if e.SyncTo != "" {
+		if e.SpRef, err = rf(e.SyncTo); err != nil {
+			return
+		}
+	}
+	if e.SyncPoints != "" {
+		if e.SyncPointsData, err = os.ReadFile(e.SyncPoints); err != nil {
+			return
+		}
+	}
+	if e.Replace != "" {
+		if e.ReplaceData, err = os.ReadFile(e.Replace); err != nil {
 			return
 		}
 	}
 	return
 }
 
-// writeFiles writes the output files specified by the '-out' and '-out2' flags.
+// writeFiles writes the output files specified by the '-out' and '-out2' flags (or the parts of '-splitAt').
 func writeFiles() (err error) {
+	_, outEnc, err := e.Encodings()
+	if err != nil {
+		return
+	}
+
 	wf := func(name string, sp *srtgears.SubsPack) (err error) {
-		ext := strings.ToLower(path.Ext(name))
-		switch ext {
-		case ".srt":
-			return srtgears.WriteSrtFile(name, sp)
-		case ".ssa":
-			return srtgears.WriteSsaFile(name, sp)
-		case "":
+		ext := path.Ext(name)
+		if ext == "" {
 			return fmt.Errorf("Output extension not specified!")
 		}
-		return fmt.Errorf("Unsupported file extension, only *.srt and *.ssa are supported: %s", ext)
-	}
-
-	if e.Out != "" && e.Sp1 != nil {
-		if err = wf(e.Out, e.Sp1); err != nil {
+		f := srtgears.FormatByExt(ext)
+		if f == nil {
+			return fmt.Errorf("Unsupported file extension, only %s are supported: %s", exec.ExtList(), ext)
+		}
+		file, err := os.Create(name)
+		if err != nil {
 			return
 		}
+		defer file.Close()
+		debugf("Writing %d subtitles to file: %s (%s, %s)", len(sp.Subs), name, f.Name(), outEnc)
+		return e.ConfigFormat(f, true).Write(outEnc.NewWriter(file), sp)
 	}
-	if e.Out2 != "" && e.Sp2 != nil {
-		if err = wf(e.Out2, e.Sp2); err != nil {
+
+	for _, o := range e.Outputs() {
+		if err = wf(o.Name, o.Sp); err != nil {
 			return
 		}
 	}
 	return
 }
 
+// debugf prints a debug message if debug is enabled ('-debug' flag).
+func debugf(format string, a ...interface{}) {
+	if srtgears.Debug {
+		log.Printf("[DEBUG] "+format, a...)
+	}
+}
+
 const examples = `
 Examples:
 Merge 2 files to have a dual sub saved in Sub Station Alpha (*.ssa) format:
@@ -108,5 +181,45 @@ Concatenate 2 files where 2nd part of the movie starts at 51 min 15 sec:
     srtgears -in cd1.srt -in2 cd2.srt -out cd12.srt -concat=00:51:15:00,000
 Change subtitle color to yellow, move to top, remove HI lines, increase display duration by 10% and save as *.ssa:
     srtgears -in eng.srt -out eng2.ssa -color=yellow -pos=T -removehi -lengthen=1.1
+Convert a MicroDVD file having no frame rate header to *.srt:
+    srtgears -in movie.sub -out movie.srt -fps=23.976
+Convert a Windows-1250 encoded file (encoding is also detected if omitted) to UTF-8:
+    srtgears -in hun.srt -out hun-utf8.srt -inEnc=Windows-1250
+Resync: subtitle #12 should appear at 00:01:05,200 and subtitle #880 at 01:42:10,050:
+    srtgears -in eng.srt -out eng2.srt -sync="#12=00:01:05,200 #880=01:42:10,050"
+Resync subtitles of a different cut using the sync points listed in points.txt (e.g. "#1=00:00:12,000 #300=00:25:10,500"):
+    srtgears -in eng.srt -out eng2.srt -syncPoints=points.txt -syncExtrap=linear
+Align a badly timed translation to a correctly timed original (based on timing only) and merge them:
+    srtgears -in hun.srt -in2 eng.srt -syncTo eng.srt -merge -out eng+hun.ssa
+Sync subtitles to the soundtrack of the movie (PCM WAV, e.g. extracted with "ffmpeg -i movie.mkv -vn -ac 1 -ar 16000 movie.wav"):
+    srtgears -in eng.srt -out eng2.srt -syncAudio movie.wav
+Convert subtitles of a PAL (25 fps) release to NTSC film (23.976 fps), snapping timestamps to frames:
+    srtgears -in eng.srt -out eng2.srt -fps=25:23.976 -fpsSnap
+Split a programme starting at SMPTE timecode 01:00:00:00 at drop-frame timecode 01:42:10;12 (29.97 fps):
+    srtgears -in eng.srt -out eng1.srt -out2 eng2.srt -tcFps=29.97 -tcOrigin=01:00:00:00 -splitAt="01:42:10;12"
+Normalize timing: display subtitles for 1-7 seconds, with a gap of at least 2 frames (at 24 fps) between them:
+    srtgears -in eng.srt -out eng2.srt -minDur=1000 -maxDur=7000 -minGap=83
+Split subtitles of a 3 disc release to movie.cd1.srt, movie.cd2.srt and movie.cd3.srt, clipping subtitles at the split times:
+    srtgears -in movie.srt -out movie.cd%d.srt -splitAt="00:51:15,000 01:40:02,500" -splitClip
+Remove a deleted scene (00:10:00-00:12:30) and then insert a 2 minute ad break at 00:17:30:
+    srtgears -in eng.srt -out eng2.srt -cut=00:10:00,000-00:12:30,000 -insertGap=00:17:30,000+00:02:00,000
+Keep only the subtitles of a clip, rebased to zero:
+    srtgears -in eng.srt -out clip.srt -extract=00:10:00,000-00:12:30,000
+Concatenate 2 files and resolve the overlaps at the joint by trimming previous subtitles:
+    srtgears -in cd1.srt -in2 cd2.srt -out cd12.srt -concat=00:51:15,000 -overlaps=trim
+Recompute display durations for slow readers (12 characters per second, displayed for 1-7 seconds):
+    srtgears -in eng.srt -out eng2.srt -cps=12 -minDur=1000 -maxDur=7000
+Re-break the text of subtitles into balanced lines of max 37 characters:
+    srtgears -in eng.srt -out eng2.srt -maxLineLen=37
+Merge subtitles shorter than 1 second with a gap less than 250 ms into dialogues:
+    srtgears -in eng.srt -out eng2.srt -mergeShort=250 -minDur=1000 -dialogue
+Split long subtitles (e.g. of machine transcripts) to fit 2 lines of 42 characters and 7 seconds:
+    srtgears -in transcript.srt -out eng.srt -splitLong -maxLineLen=42 -maxDur=7000
+Remove all hearing impaired texts including speaker labels, inline cues and music:
+    srtgears -in eng.srt -out eng2.srt -removehi -hiModes=all
+Fix recurring OCR and style errors using find and replace rules (keeping formatting intact):
+    srtgears -in eng.srt -out eng2.srt -replace=rules.txt -keepTags
+Check subtitles before delivery, with max 37 characters per line (fails if errors are found):
+    srtgears -in eng.srt -lint -lintRules=maxLineLen=37
 Repair: do nothing, just parse and re-save
     srtgears -in eng.srt -out eng2.srt`
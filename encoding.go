@@ -0,0 +1,424 @@
+/*
+
+This file implements character encoding detection and conversion, so subtitle files
+which are not UTF-8 encoded can also be read, and output can be written in other encodings.
+
+Supported encodings are UTF-8, UTF-16 (little and big endian) and the most common
+single-byte codepages of the regions where subtitles are not UTF-8 encoded
+(Windows-1250, ISO-8859-2, Windows-1252, ISO-8859-1 and Windows-1251).
+
+Detection:
+ - a BOM (byte order mark) tells the encoding;
+ - UTF-16 without BOM is recognized by the zero bytes of ASCII characters
+   (checked before UTF-8 as ASCII characters of UTF-16 are also valid UTF-8);
+ - data without BOM is UTF-8 if it is valid UTF-8;
+ - else the single-byte codepages are scored by how "natural" the decoded text looks
+   (letters inside words, no control characters, no mixed scripts inside words,
+   frequent accented letters of the languages using the codepage), the best one wins.
+
+*/
+
+package srtgears
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is a character encoding of subtitle files.
+type Encoding struct {
+	Name    string   // Name of the encoding, e.g. "Windows-1250"
+	Aliases []string // Other (lower case) names of the encoding, e.g. "cp1250"
+
+	bom   []byte           // Byte order mark, nil if not applicable
+	order binary.ByteOrder // Byte order for UTF-16 encodings
+	table *[128]rune       // Characters of bytes 0x80-0xFF for single-byte encodings
+
+	revOnce sync.Once     // Used to lazily build rev
+	rev     map[rune]byte // Reverse of table, used when encoding
+}
+
+// Supported encodings.
+var (
+	UTF8        = &Encoding{Name: "UTF-8", Aliases: []string{"utf8"}, bom: []byte{0xef, 0xbb, 0xbf}}
+	UTF16LE     = &Encoding{Name: "UTF-16LE", Aliases: []string{"utf16le", "utf-16", "utf16", "unicode"}, bom: []byte{0xff, 0xfe}, order: binary.LittleEndian}
+	UTF16BE     = &Encoding{Name: "UTF-16BE", Aliases: []string{"utf16be"}, bom: []byte{0xfe, 0xff}, order: binary.BigEndian}
+	Windows1250 = &Encoding{Name: "Windows-1250", Aliases: []string{"cp1250"}, table: &windows1250Table}
+	ISO8859_2   = &Encoding{Name: "ISO-8859-2", Aliases: []string{"latin2", "iso8859-2"}, table: &iso88592Table}
+	Windows1252 = &Encoding{Name: "Windows-1252", Aliases: []string{"cp1252"}, table: &windows1252Table}
+	ISO8859_1   = &Encoding{Name: "ISO-8859-1", Aliases: []string{"latin1", "iso8859-1"}, table: &iso88591Table}
+	Windows1251 = &Encoding{Name: "Windows-1251", Aliases: []string{"cp1251"}, table: &windows1251Table}
+)
+
+// All supported encodings.
+var encodings = []*Encoding{UTF8, UTF16LE, UTF16BE, Windows1250, ISO8859_2, Windows1252, ISO8859_1, Windows1251}
+
+// Single-byte encodings tried when detecting, in order of preference (in case of equal scores),
+// with the non-ASCII letters typical in the languages using them; the first ones are the most
+// frequent letters which distinguish the encoding from the others.
+// ISO-8859-1 is not listed as Windows-1252 is its superset (for printable characters).
+var detectedSingleByteEncodings = []struct {
+	enc      *Encoding
+	frequent string
+	letters  string
+}{
+	{Windows1250, "őűčřěš", "áéíóöúüďňťžůýĺľŕäôłśćńźżąęăâîșțşţ"},
+	{ISO8859_2, "őűčřěš", "áéíóöúüďňťžůýĺľŕäôłśćńźżąęăâîșțşţ"},
+	{Windows1252, "àçèêñù", "áâãäåæéëìíîïòóôõöøúûüýÿßœšž"},
+	{Windows1251, "", "абвгдеёжзийклмнопрстуфхцчшщъыьэюяіїєґўђѓћќџљњ"},
+}
+
+// Encodings returns the supported encodings.
+func Encodings() []*Encoding {
+	return append([]*Encoding(nil), encodings...)
+}
+
+// EncodingByName returns the encoding of the given name or alias (case insensitive).
+// Returns nil if the encoding is not supported.
+func EncodingByName(name string) *Encoding {
+	name = strings.ToLower(name)
+	for _, enc := range encodings {
+		if strings.ToLower(enc.Name) == name {
+			return enc
+		}
+		for _, alias := range enc.Aliases {
+			if alias == name {
+				return enc
+			}
+		}
+	}
+	return nil
+}
+
+// String returns the name of the encoding.
+func (enc *Encoding) String() string {
+	return enc.Name
+}
+
+// DetectEncoding detects the encoding of the data.
+func DetectEncoding(data []byte) *Encoding {
+	// BOM
+	for _, enc := range []*Encoding{UTF8, UTF16LE, UTF16BE} {
+		if bytes.HasPrefix(data, enc.bom) {
+			return enc
+		}
+	}
+
+	// UTF-16 without BOM: ASCII characters have a zero byte
+	sample := data
+	if len(sample) > sniffLen {
+		sample = sample[:sniffLen]
+	}
+	var zeros [2]int // Zero bytes at even and odd positions
+	for i, b := range sample {
+		if b == 0 {
+			zeros[i%2]++
+		}
+	}
+	if pairs := len(sample) / 2; pairs > 0 {
+		switch {
+		case zeros[1]*10 > pairs*4:
+			return UTF16LE
+		case zeros[0]*10 > pairs*4:
+			return UTF16BE
+		}
+	}
+
+	if utf8.Valid(data) {
+		return UTF8
+	}
+
+	// Single-byte codepages
+	var best *Encoding
+	bestScore := 0
+	for _, d := range detectedSingleByteEncodings {
+		text := []rune(string(d.enc.Decode(data)))
+		if score := scoreText(text, d.frequent, d.letters); best == nil || score > bestScore {
+			best, bestScore = d.enc, score
+		}
+	}
+	return best
+}
+
+// scoreText tells how "natural" a decoded text looks like, the higher the better.
+// frequent and letters are the typical (lower case) non-ASCII letters of the encoding.
+func scoreText(text []rune, frequent, letters string) (score int) {
+	isLetter := func(i int) bool {
+		return i >= 0 && i < len(text) && unicode.IsLetter(text[i])
+	}
+	isCyrillic := func(r rune) bool {
+		return unicode.Is(unicode.Cyrillic, r)
+	}
+
+	for i, r := range text {
+		if r < 0x80 {
+			continue // ASCII is the same in all single-byte encodings
+		}
+		switch {
+		case r == utf8.RuneError || unicode.IsControl(r):
+			score -= 20
+		case unicode.IsLetter(r):
+			for _, j := range []int{i - 1, i + 1} {
+				if !isLetter(j) {
+					continue
+				}
+				switch {
+				case isCyrillic(r) != isCyrillic(text[j]):
+					score -= 5 // Mixed scripts inside a word
+				case j > i && unicode.IsLower(r) && unicode.IsUpper(text[j]),
+					j < i && unicode.IsLower(text[j]) && unicode.IsUpper(r):
+					score -= 5 // Upper case letter after lower case inside a word
+				default:
+					score++ // Letter inside a word
+				}
+			}
+			switch lr := unicode.ToLower(r); {
+			case strings.ContainsRune(frequent, lr):
+				score += 2
+			case strings.ContainsRune(letters, lr):
+				score++
+			default:
+				score -= 2 // Not used by the languages of the encoding
+			}
+		default:
+			if isLetter(i-1) && isLetter(i+1) {
+				score -= 5 // Symbol inside a word
+			}
+		}
+	}
+	return
+}
+
+// Decode converts data in this encoding to UTF-8. The BOM (if present) is stripped off.
+func (enc *Encoding) Decode(data []byte) []byte {
+	if enc.bom != nil {
+		data = bytes.TrimPrefix(data, enc.bom)
+	}
+
+	switch {
+	case enc.order != nil: // UTF-16
+		u := make([]uint16, len(data)/2)
+		for i := range u {
+			u[i] = enc.order.Uint16(data[i*2:])
+		}
+		return []byte(string(utf16.Decode(u)))
+	case enc.table != nil: // Single-byte
+		buf := make([]byte, 0, len(data)+len(data)/4)
+		for _, b := range data {
+			if b < 0x80 {
+				buf = append(buf, b)
+			} else {
+				buf = utf8.AppendRune(buf, enc.table[b-0x80])
+			}
+		}
+		return buf
+	}
+	return data // UTF-8
+}
+
+// Encode converts UTF-8 data to this encoding. No BOM is added.
+// Characters that cannot be represented in the encoding are replaced by '?'.
+func (enc *Encoding) Encode(data []byte) []byte {
+	switch {
+	case enc.order != nil: // UTF-16
+		u := utf16.Encode([]rune(string(data)))
+		buf := make([]byte, len(u)*2)
+		for i, v := range u {
+			enc.order.PutUint16(buf[i*2:], v)
+		}
+		return buf
+	case enc.table != nil: // Single-byte
+		enc.revOnce.Do(func() {
+			enc.rev = make(map[rune]byte, len(enc.table))
+			for i, r := range enc.table {
+				if r != utf8.RuneError {
+					enc.rev[r] = byte(0x80 + i)
+				}
+			}
+		})
+		buf := make([]byte, 0, len(data))
+		for _, r := range string(data) {
+			if r < 0x80 {
+				buf = append(buf, byte(r))
+			} else if b, ok := enc.rev[r]; ok {
+				buf = append(buf, b)
+			} else {
+				buf = append(buf, '?')
+			}
+		}
+		return buf
+	}
+	return data // UTF-8
+}
+
+// ToUTF8 converts data to UTF-8. If enc is nil, the encoding is detected.
+// The BOM (if present) is stripped off. Returns the converted data and the encoding of the input.
+func ToUTF8(data []byte, enc *Encoding) ([]byte, *Encoding) {
+	if enc == nil {
+		enc = DetectEncoding(data)
+	}
+	return enc.Decode(data), enc
+}
+
+// NewWriter returns an io.Writer which converts UTF-8 data written to it to this encoding
+// and writes the result to w. A UTF-8 BOM at the beginning is replaced by the BOM of this encoding
+// (or dropped if the encoding has no BOM).
+func (enc *Encoding) NewWriter(w io.Writer) io.Writer {
+	if enc == UTF8 {
+		return w
+	}
+	return &encodingWriter{w: w, enc: enc}
+}
+
+// encodingWriter converts UTF-8 data to an encoding.
+type encodingWriter struct {
+	w       io.Writer // Destination writer
+	enc     *Encoding // Target encoding
+	started bool      // Tells if anything was written yet
+	pending []byte    // Incomplete UTF-8 sequence at the end of the last write
+}
+
+// Write implements io.Writer.
+func (ew *encodingWriter) Write(p []byte) (n int, err error) {
+	data := append(ew.pending, p...)
+	ew.pending = nil
+
+	if !ew.started {
+		if len(data) < len(UTF8.bom) && bytes.HasPrefix(UTF8.bom, data) {
+			ew.pending = data // Can't tell yet if it's a BOM
+			return len(p), nil
+		}
+		ew.started = true
+		if bytes.HasPrefix(data, UTF8.bom) {
+			data = data[len(UTF8.bom):]
+			if ew.enc.bom != nil {
+				if _, err = ew.w.Write(ew.enc.bom); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	// Hold back an incomplete rune at the end
+	end := len(data)
+	for i := end - 1; i >= 0 && i >= end-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	ew.pending = append([]byte(nil), data[end:]...)
+
+	if _, err = ew.w.Write(ew.enc.Encode(data[:end])); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// Windows-1250 (Central European) characters of bytes 0x80-0xFF.
+var windows1250Table = [128]rune{
+	0x20AC, 0xFFFD, 0x201A, 0xFFFD, 0x201E, 0x2026, 0x2020, 0x2021,
+	0xFFFD, 0x2030, 0x0160, 0x2039, 0x015A, 0x0164, 0x017D, 0x0179,
+	0xFFFD, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0xFFFD, 0x2122, 0x0161, 0x203A, 0x015B, 0x0165, 0x017E, 0x017A,
+	0x00A0, 0x02C7, 0x02D8, 0x0141, 0x00A4, 0x0104, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x015E, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x017B,
+	0x00B0, 0x00B1, 0x02DB, 0x0142, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x0105, 0x015F, 0x00BB, 0x013D, 0x02DD, 0x013E, 0x017C,
+	0x0154, 0x00C1, 0x00C2, 0x0102, 0x00C4, 0x0139, 0x0106, 0x00C7,
+	0x010C, 0x00C9, 0x0118, 0x00CB, 0x011A, 0x00CD, 0x00CE, 0x010E,
+	0x0110, 0x0143, 0x0147, 0x00D3, 0x00D4, 0x0150, 0x00D6, 0x00D7,
+	0x0158, 0x016E, 0x00DA, 0x0170, 0x00DC, 0x00DD, 0x0162, 0x00DF,
+	0x0155, 0x00E1, 0x00E2, 0x0103, 0x00E4, 0x013A, 0x0107, 0x00E7,
+	0x010D, 0x00E9, 0x0119, 0x00EB, 0x011B, 0x00ED, 0x00EE, 0x010F,
+	0x0111, 0x0144, 0x0148, 0x00F3, 0x00F4, 0x0151, 0x00F6, 0x00F7,
+	0x0159, 0x016F, 0x00FA, 0x0171, 0x00FC, 0x00FD, 0x0163, 0x02D9,
+}
+
+// ISO-8859-2 (Latin-2, Central European) characters of bytes 0x80-0xFF.
+var iso88592Table = [128]rune{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x008D, 0x008E, 0x008F,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009A, 0x009B, 0x009C, 0x009D, 0x009E, 0x009F,
+	0x00A0, 0x0104, 0x02D8, 0x0141, 0x00A4, 0x013D, 0x015A, 0x00A7,
+	0x00A8, 0x0160, 0x015E, 0x0164, 0x0179, 0x00AD, 0x017D, 0x017B,
+	0x00B0, 0x0105, 0x02DB, 0x0142, 0x00B4, 0x013E, 0x015B, 0x02C7,
+	0x00B8, 0x0161, 0x015F, 0x0165, 0x017A, 0x02DD, 0x017E, 0x017C,
+	0x0154, 0x00C1, 0x00C2, 0x0102, 0x00C4, 0x0139, 0x0106, 0x00C7,
+	0x010C, 0x00C9, 0x0118, 0x00CB, 0x011A, 0x00CD, 0x00CE, 0x010E,
+	0x0110, 0x0143, 0x0147, 0x00D3, 0x00D4, 0x0150, 0x00D6, 0x00D7,
+	0x0158, 0x016E, 0x00DA, 0x0170, 0x00DC, 0x00DD, 0x0162, 0x00DF,
+	0x0155, 0x00E1, 0x00E2, 0x0103, 0x00E4, 0x013A, 0x0107, 0x00E7,
+	0x010D, 0x00E9, 0x0119, 0x00EB, 0x011B, 0x00ED, 0x00EE, 0x010F,
+	0x0111, 0x0144, 0x0148, 0x00F3, 0x00F4, 0x0151, 0x00F6, 0x00F7,
+	0x0159, 0x016F, 0x00FA, 0x0171, 0x00FC, 0x00FD, 0x0163, 0x02D9,
+}
+
+// Windows-1252 (Western European) characters of bytes 0x80-0xFF.
+var windows1252Table = [128]rune{
+	0x20AC, 0xFFFD, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0xFFFD, 0x017D, 0xFFFD,
+	0xFFFD, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0xFFFD, 0x017E, 0x0178,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x00B9, 0x00BA, 0x00BB, 0x00BC, 0x00BD, 0x00BE, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
+
+// ISO-8859-1 (Latin-1, Western European) characters of bytes 0x80-0xFF.
+var iso88591Table = [128]rune{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x008D, 0x008E, 0x008F,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009A, 0x009B, 0x009C, 0x009D, 0x009E, 0x009F,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x00B9, 0x00BA, 0x00BB, 0x00BC, 0x00BD, 0x00BE, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
+
+// Windows-1251 (Cyrillic) characters of bytes 0x80-0xFF.
+var windows1251Table = [128]rune{
+	0x0402, 0x0403, 0x201A, 0x0453, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x20AC, 0x2030, 0x0409, 0x2039, 0x040A, 0x040C, 0x040B, 0x040F,
+	0x0452, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0xFFFD, 0x2122, 0x0459, 0x203A, 0x045A, 0x045C, 0x045B, 0x045F,
+	0x00A0, 0x040E, 0x045E, 0x0408, 0x00A4, 0x0490, 0x00A6, 0x00A7,
+	0x0401, 0x00A9, 0x0404, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x0407,
+	0x00B0, 0x00B1, 0x0406, 0x0456, 0x0491, 0x00B5, 0x00B6, 0x00B7,
+	0x0451, 0x2116, 0x0454, 0x00BB, 0x0458, 0x0405, 0x0455, 0x0457,
+	0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+	0x0418, 0x0419, 0x041A, 0x041B, 0x041C, 0x041D, 0x041E, 0x041F,
+	0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+	0x0428, 0x0429, 0x042A, 0x042B, 0x042C, 0x042D, 0x042E, 0x042F,
+	0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+	0x0438, 0x0439, 0x043A, 0x043B, 0x043C, 0x043D, 0x043E, 0x043F,
+	0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+	0x0448, 0x0449, 0x044A, 0x044B, 0x044C, 0x044D, 0x044E, 0x044F,
+}
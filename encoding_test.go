@@ -0,0 +1,30 @@
+package srtgears
+
+import (
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	srt := "1\r\n00:00:01,000 --> 00:00:02,000\r\nHello, World!\r\n"
+	cases := []struct {
+		name string
+		data []byte
+		exp  *Encoding
+	}{
+		{"UTF-8", []byte(srt + "Árvíztűrő tükörfúrógép\r\n"), UTF8},
+		{"UTF-8 BOM", append(UTF8.bom, srt...), UTF8},
+		{"UTF-16LE BOM", append(UTF16LE.bom, UTF16LE.Encode([]byte(srt))...), UTF16LE},
+		{"UTF-16BE BOM", append(UTF16BE.bom, UTF16BE.Encode([]byte(srt))...), UTF16BE},
+		{"UTF-16LE no BOM", UTF16LE.Encode([]byte(srt)), UTF16LE},
+		{"UTF-16BE no BOM", UTF16BE.Encode([]byte(srt)), UTF16BE},
+		{"Windows-1250", Windows1250.Encode([]byte(srt + "Árvíztűrő tükörfúrógép, és még sok más szöveg.\r\n")), Windows1250},
+		{"ISO-8859-2", ISO8859_2.Encode([]byte(srt + "Zażółć gęślą jaźń, śliczna łąka.\r\n")), ISO8859_2},
+		{"Windows-1252", Windows1252.Encode([]byte(srt + "C’est déjà l’été… très élégant!\r\n")), Windows1252},
+		{"Windows-1251", Windows1251.Encode([]byte(srt + "Привет, как дела? Всё хорошо.\r\n")), Windows1251},
+	}
+	for _, c := range cases {
+		if got := DetectEncoding(c.data); got != c.exp {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, got)
+		}
+	}
+}
@@ -49,4 +49,13 @@ func Example_misc() {
 	check(err) // Check / handle error
 }
 
+// This example shows how to convert a subtitle file to another format.
+// Formats are chosen by file name extension (input format is detected by content if extension is unknown).
+func Example_convert() {
+	sp, err := srtgears.ReadFile("eng.srt")
+	check(err) // Check / handle error
+	err = srtgears.WriteFile("eng.vtt", sp)
+	check(err) // Check / handle error
+}
+
 func check(err error) {}
@@ -12,9 +12,12 @@ import (
 	"flag"
 	"fmt"
 	"github.com/icza/srtgears"
+	"github.com/icza/srtgears/audiosync"
 	"io"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,30 +26,82 @@ type Executor struct {
 	FlagSet *flag.FlagSet // Custom Flagset used to parse parameters
 	output  io.Writer     // Output used to write error messages and stats ('-stats' param)
 
-	In         string  // input file name (*.srt)
-	Out        string  // output file name (*.srt or *.ssa)
-	In2        string  // optional 2nd input file name (when merging or concatenating subtitles) (*.srt)
-	Out2       string  // optional 2nd output file name (when splitting) (*.srt or *.ssa)
-	Concat     string  // concatenate 2 subtitle files, 2nd part start at e.g. '00:59:00,123'
+	In         string  // input file name (any of srtgears.FormatExtensions())
+	Out        string  // output file name (any of srtgears.FormatExtensions()); when splitting, may be a file name template, e.g. 'movie.cd%d.srt'
+	In2        string  // optional 2nd input file name (when merging or concatenating subtitles) (any of srtgears.FormatExtensions())
+	Out2       string  // optional 2nd output file name (when splitting) (any of srtgears.FormatExtensions())
+	Concat     string  // concatenate 2 subtitle files, 2nd part start at e.g. '00:59:00,123' or SMPTE timecode '00:59:00:03'
 	Merge      bool    // merge 2 subtitle files ('-in' at bottom, '-in2' at top
-	SplitAt    string  // time at which to split to 2 subtitle files ('-out' and '-out2'), e.g. '00:59:00,123'
+	SplitAt    string  // time(s) at which to split to subtitle files ('-out' and '-out2', or the '-out' template), separated by spaces, e.g. '00:59:00,123' or SMPTE timecode '00:59:00:03'
+	SplitClip  bool    // when splitting, clip subtitles straddling a split time (the rest is added to the next part) instead of leaving them in the part they start in
+	Cut        string  // remove time ranges (e.g. deleted scenes) and pull subtitles after them back, separated by spaces, each 'from-to', e.g. '00:10:00,000-00:12:30,000'
+	InsertGap  string  // insert a gap (e.g. for an ad break) and push subtitles after it forward, 'at+length', e.g. '00:20:00,000+00:02:00,000'
+	Extract    string  // keep only a time range (e.g. a clip) rebased to zero, 'from-to', e.g. '00:10:00,000-00:12:30,000'
 	ShiftBy    int     // shift subtitle timestamps (+/- ms)
 	Scale      float64 // scale subtitle timestamps (faster/slower); multiplier e.g. 1.001
 	Lengthen   float64 // lengthen / shorten display duration of subtitles, multiplier e.g. for +10% use 1.1
+	Overlaps   string  // resolve overlapping subtitles, one of: trim (previous), shift (next), combine (text of segments), stack (positions)
+	CPS        float64 // recompute display durations from reading speed, in characters per second, e.g. 15 (bounded by '-minDur' and '-maxDur')
+	WPM        float64 // recompute display durations from reading speed, in words per minute, e.g. 160 (bounded by '-minDur' and '-maxDur')
+	MinDur     int     // min display duration of subtitles (ms), shorter ones are lengthened (not past the next subtitle)
+	MaxDur     int     // max display duration of subtitles (ms), longer ones are shortened
+	MinGap     int     // min gap before the next subtitle (ms), e.g. 83 (2 frames at 24 fps); overlaps are removed too
+	Replace    string  // file of find and replace rules applied in order to the text of subtitles, each 'find => replacement' (regexp finds between slashes, e.g. '/ +([,!?])/ => $1')
+	KeepTags   bool    // apply '-replace' rules only outside of formatting tags and controls
 	RemoveHTML bool    // strip off formatting (e.g. <i>, <b>, <u>, <font> etc.)
 	RemoveCtrl bool    // remove controls such as {\anX} (or {\aY}), {\pos(x,y)}
 	RemoveHI   bool    // remove hearing impaired subtitles (such as '[PHONE RINGING]' or '(phone ringing)')
+	HIModes    string  // hearing impaired removal modes of '-removehi', comma separated list of: lines, inline, speakers, music, multiline, dashes; or all (default: lines)
+	MaxLineLen int     // re-break the text of subtitles into balanced lines not longer than this (in characters, formatting excluded), e.g. 42
+	MaxLines   int     // max number of lines of subtitles used by '-maxLineLen' and '-splitLong'
+	Reflow     string  // shape of the lines re-broken by '-maxLineLen', one of: pyramid (each line longer than the one above), bottom (bottom-heavy: the last line is the longest) (default: pyramid)
+	MergeShort int     // merge adjacent subtitles with a gap shorter than this (ms) if one of them is shorter than '-minDur' (any if not specified) and the combined text fits '-maxLineLen' and '-maxLines', e.g. 250
+	Dialogue   bool    // format subtitles merged by '-mergeShort' as a two-speaker dialogue (lines with leading dashes)
+	SplitLong  bool    // split subtitles whose text doesn't fit '-maxLineLen' and '-maxLines' or displayed longer than '-maxDur' into several consecutive subtitles
 	Pos        string  // change subtitle position, one of: BL, B, BR, L, C, R, TL, T, TR  (B: bottom, T: Top, L: Left, R: Right, C: Center)
 	Color      string  // change subtitle color, name (e.g. 'red' or 'yellow') or RGB hexa '#rrggbb' (e.g.'#ff0000' for red)
 	Stats      bool    // analyze file and print statistics
+	Fps        string  // frame rate of MicroDVD (*.sub) files (for input only used if not specified by the file), e.g. '23.976'; or 'from:to' to convert frame rate, e.g. '25:23.976'
+	FpsSnap    bool    // snap timestamps to the frames of the (target) frame rate specified by '-fps'
+	TcFps      string  // frame rate of SMPTE timecodes in time arguments (e.g. '01:00:12:14', drop-frame '01:00:12;14'), e.g. '29.97'; defaults to the (target) frame rate of '-fps'
+	TcOrigin   string  // timecode origin (programme start) to rebase subtitles from to zero, e.g. '01:00:00:00'; timecodes in time arguments are relative to it too
+	InEnc      string  // character encoding of input files, e.g. 'Windows-1250' or 'UTF-16LE'; 'auto' to detect
+	OutEnc     string  // character encoding of output files, e.g. 'Windows-1250' or 'UTF-16LE'
+	Sync       string  // resync using 2 reference points, each 'from=to' where from is a time or a subtitle number, e.g. '#12=00:01:05,200 #880=01:42:10,050'
+	SyncPoints string  // file of sync points for piecewise-linear resync, separated by spaces or newlines, each 'from=to' (same as for '-sync')
+	SyncExtrap string  // extrapolation of '-syncPoints' before the first and after the last point, one of: shift, linear, none
+	SyncTo     string  // reference subtitle file to automatically align to (based on timing only), e.g. a correctly timed original (any of srtgears.FormatExtensions())
+	SyncAudio  string  // soundtrack (PCM WAV file) to automatically sync to (by voice activity detection), e.g. 'movie.wav'
+	Lint       bool    // check subtitles (quality control) and print a report, fails if errors are found
+	LintRules  string  // limits used by lint, overriding the defaults, e.g. 'maxLineLen=37,maxCPS=17,minGap=0' (durations in ms)
 
 	Modified bool // Flag telling if transformation was performed on loaded subtitle(s) (set by GearIt())
 
-	// Callback function to be called if stats "transformation" to be performed and no errors occurred.
-	// Stats is special because it is the only transformation that produces output to Output (and not to file).
+	// Callback function to be called if stats or lint "transformation" to be performed and no errors occurred.
+	// Stats and lint are special because they are the only transformations that produce output to Output (and not to file).
 	BeforeStats func()
 
 	Sp1, Sp2 *srtgears.SubsPack // SubsPacks to operate on. Must be set by the user before calling GearIt()!
+
+	Parts []*srtgears.SubsPack // Parts produced by '-splitAt' (set by GearIt()), Sp1 and Sp2 are the first 2 parts
+
+	SyncPointsData []byte // Content of the '-syncPoints' file. Must be set by the user before calling GearIt() if '-syncPoints' is specified!
+
+	ReplaceData []byte // Content of the '-replace' file. Must be set by the user before calling GearIt() if '-replace' is specified!
+
+	SpRef *srtgears.SubsPack // Reference SubsPack of '-syncTo'. Must be set by the user before calling GearIt() if '-syncTo' is specified!
+
+	Audio io.Reader // Content of the '-syncAudio' file. Must be set by the user before calling GearIt() if '-syncAudio' is specified!
+
+	SyncResult *srtgears.AlignResult // Result of aligning to '-syncTo' or '-syncAudio' (set by GearIt())
+
+	OverlapsFound []srtgears.Overlap // Overlaps resolved by '-overlaps' (set by GearIt())
+
+	ReplaceCounts []int // Number of replacements per '-replace' rule (set by GearIt())
+
+	ShortMerged int // Number of subtitles merged into their previous one by '-mergeShort' (set by GearIt())
+
+	LongSplit int // Number of subtitles split by '-splitLong' (set by GearIt())
 }
 
 // New creates a new Executor.
@@ -69,27 +124,140 @@ func (e *Executor) SetOutput(output io.Writer) {
 func (e *Executor) ProcFlags(arguments []string) error {
 	f := e.FlagSet
 
-	f.StringVar(&e.In, "in", "", "input file name (*.srt)")
-	f.StringVar(&e.Out, "out", "", "output file name (*.srt or *.ssa)")
-	f.StringVar(&e.In2, "in2", "", "optional 2nd input file name (when merging or concatenating subtitles) (*.srt)")
-	f.StringVar(&e.Out2, "out2", "", "optional 2nd output file name (when splitting) (*.srt or *.ssa)")
+	exts := ExtList()
+	f.StringVar(&e.In, "in", "", "input file name ("+exts+")")
+	f.StringVar(&e.Out, "out", "", "output file name ("+exts+"); when splitting, may be a file name template, e.g. 'movie.cd%d.srt'")
+	f.StringVar(&e.In2, "in2", "", "optional 2nd input file name (when merging or concatenating subtitles) ("+exts+")")
+	f.StringVar(&e.Out2, "out2", "", "optional 2nd output file name (when splitting) ("+exts+")")
 	f.BoolVar(&srtgears.Debug, "debug", true, "print debug messages")
-	f.StringVar(&e.Concat, "concat", "", "concatenate 2 subtitle files, 2nd part start at e.g. '00:59:00,123'")
+	f.StringVar(&e.Concat, "concat", "", "concatenate 2 subtitle files, 2nd part start at e.g. '00:59:00,123' or SMPTE timecode '00:59:00:03'")
 	f.BoolVar(&e.Merge, "merge", false, "merge 2 subtitle files ('-in' at bottom, '-in2' at top)")
-	f.StringVar(&e.SplitAt, "splitAt", "", "time at which to split to 2 subtitle files ('-out' and '-out2'), e.g. '00:59:00,123'")
+	f.StringVar(&e.SplitAt, "splitAt", "", "time(s) at which to split to subtitle files ('-out' and '-out2', or the '-out' template), separated by spaces, "+
+		"e.g. '00:59:00,123' or SMPTE timecode '00:59:00:03'")
+	f.BoolVar(&e.SplitClip, "splitClip", false, "when splitting, clip subtitles straddling a split time (the rest is added to the next part) "+
+		"instead of leaving them in the part they start in")
+	f.StringVar(&e.Cut, "cut", "", "remove time ranges (e.g. deleted scenes) and pull subtitles after them back, separated by spaces, each 'from-to', e.g. '00:10:00,000-00:12:30,000'")
+	f.StringVar(&e.InsertGap, "insertGap", "", "insert a gap (e.g. for an ad break) and push subtitles after it forward, 'at+length', e.g. '00:20:00,000+00:02:00,000'")
+	f.StringVar(&e.Extract, "extract", "", "keep only a time range (e.g. a clip) rebased to zero, 'from-to', e.g. '00:10:00,000-00:12:30,000'")
 	f.IntVar(&e.ShiftBy, "shiftBy", 0, "shift subtitle timestamps (+/- ms)")
 	f.Float64Var(&e.Scale, "scale", 0, "scale subtitle timestamps (faster/slower); multiplier e.g. 1.001")
 	f.Float64Var(&e.Lengthen, "lengthen", 0, "lengthen / shorten display duration of subtitles, multiplier e.g. for +10% use 1.1")
+	f.StringVar(&e.Overlaps, "overlaps", "", "resolve overlapping subtitles, one of: trim (previous), shift (next), combine (text of segments), stack (positions)")
+	f.Float64Var(&e.CPS, "cps", 0, "recompute display durations from reading speed, in characters per second, e.g. 15 (bounded by '-minDur' and '-maxDur')")
+	f.Float64Var(&e.WPM, "wpm", 0, "recompute display durations from reading speed, in words per minute, e.g. 160 (bounded by '-minDur' and '-maxDur')")
+	f.IntVar(&e.MinDur, "minDur", 0, "min display duration of subtitles (ms), shorter ones are lengthened (not past the next subtitle)")
+	f.IntVar(&e.MaxDur, "maxDur", 0, "max display duration of subtitles (ms), longer ones are shortened")
+	f.IntVar(&e.MinGap, "minGap", 0, "min gap before the next subtitle (ms), e.g. 83 (2 frames at 24 fps); overlaps are removed too")
+	f.StringVar(&e.Replace, "replace", "", "file of find and replace rules applied in order to the text of subtitles, each 'find => replacement' (regexp finds between slashes, e.g. '/ +([,!?])/ => $1')")
+	f.BoolVar(&e.KeepTags, "keepTags", false, "apply '-replace' rules only outside of formatting tags and controls")
 	f.BoolVar(&e.RemoveHTML, "removehtml", false, "strip off formatting (e.g. <i>, <b>, <u>, <font> etc.)")
 	f.BoolVar(&e.RemoveCtrl, "removectrl", false, `remove controls such as {\anX} (or {\aY}), {\pos(x,y)}`)
 	f.BoolVar(&e.RemoveHI, "removehi", false, "remove hearing impaired subtitles (such as '[PHONE RINGING]' or '(phone ringing)')")
+	f.StringVar(&e.HIModes, "hiModes", "", "hearing impaired removal modes of '-removehi', comma separated list of: lines, inline, speakers, music, multiline, dashes; or all (default: lines)")
+	f.IntVar(&e.MaxLineLen, "maxLineLen", 0, "re-break the text of subtitles into balanced lines not longer than this (in characters, formatting excluded), e.g. 42")
+	f.IntVar(&e.MaxLines, "maxLines", 2, "max number of lines of subtitles used by '-maxLineLen' and '-splitLong'")
+	f.StringVar(&e.Reflow, "reflow", "", "shape of the lines re-broken by '-maxLineLen', one of: pyramid (each line longer than the one above), bottom (bottom-heavy: the last line is the longest) (default: pyramid)")
+	f.IntVar(&e.MergeShort, "mergeShort", 0, "merge adjacent subtitles with a gap shorter than this (ms) if one of them is shorter than '-minDur' (any if not specified) and the combined text fits '-maxLineLen' and '-maxLines', e.g. 250")
+	f.BoolVar(&e.Dialogue, "dialogue", false, "format subtitles merged by '-mergeShort' as a two-speaker dialogue (lines with leading dashes)")
+	f.BoolVar(&e.SplitLong, "splitLong", false, "split subtitles whose text doesn't fit '-maxLineLen' and '-maxLines' or displayed longer than '-maxDur' into several consecutive subtitles")
 	f.StringVar(&e.Pos, "pos", "", "change subtitle position, one of: BL, B, BR, L, C, R, TL, T, TR  (B: bottom, T: Top, L: Left, R: Right, C: Center)")
 	f.StringVar(&e.Color, "color", "", "change subtitle color, name (e.g. 'red' or 'yellow') or RGB hexa '#rrggbb' (e.g.'#ff0000' for red)")
 	f.BoolVar(&e.Stats, "stats", false, "analyze file and print statistics")
+	f.StringVar(&e.Fps, "fps", "", "frame rate of MicroDVD (*.sub) files (for input only used if not specified by the file), e.g. '23.976'; "+
+		"or 'from:to' to convert frame rate, e.g. '25:23.976' (presets: 23.976, 24, 25, 29.97, 30, 50, 59.94)")
+	f.BoolVar(&e.FpsSnap, "fpsSnap", false, "snap timestamps to the frames of the (target) frame rate specified by '-fps'")
+	f.StringVar(&e.TcFps, "tcFps", "", "frame rate of SMPTE timecodes in time arguments (e.g. '01:00:12:14', drop-frame '01:00:12;14'), e.g. '29.97'; "+
+		"defaults to the (target) frame rate of '-fps'")
+	f.StringVar(&e.TcOrigin, "tcOrigin", "", "timecode origin (programme start) to rebase subtitles from to zero, e.g. '01:00:00:00'; "+
+		"timecodes in time arguments are relative to it too")
+	f.StringVar(&e.Sync, "sync", "", "resync using 2 reference points, each 'from=to' where from is a time or a subtitle number, e.g. '#12=00:01:05,200 #880=01:42:10,050'")
+	f.StringVar(&e.SyncPoints, "syncPoints", "", "file of sync points for piecewise-linear resync, separated by spaces or newlines, each 'from=to' (same as for '-sync')")
+	f.StringVar(&e.SyncExtrap, "syncExtrap", "shift", "extrapolation of '-syncPoints' before the first and after the last point, one of: shift, linear, none")
+	f.StringVar(&e.SyncTo, "syncTo", "", "reference subtitle file to automatically align to (based on timing only), e.g. a correctly timed original ("+exts+")")
+	f.StringVar(&e.SyncAudio, "syncAudio", "", "soundtrack (PCM WAV file) to automatically sync to (by voice activity detection), e.g. 'movie.wav'")
+	f.BoolVar(&e.Lint, "lint", false, "check subtitles (quality control) and print a report, fails if errors are found")
+	f.StringVar(&e.LintRules, "lintRules", "", "limits used by lint, overriding the defaults, e.g. 'maxLineLen=37,maxCPS=17,minGap=0' (durations in ms; keys: "+
+		"maxLineLen, maxLines, maxCPS, minDur, maxDur, minGap)")
+	encs := EncList()
+	f.StringVar(&e.InEnc, "inEnc", "auto", "character encoding of input files ("+encs+"); 'auto' to detect")
+	f.StringVar(&e.OutEnc, "outEnc", srtgears.UTF8.Name, "character encoding of output files ("+encs+")")
 
 	return f.Parse(arguments)
 }
 
+// ExtList returns the file name extensions of the registered formats as a human readable list,
+// e.g. "*.srt, *.ssa or *.ass".
+func ExtList() string {
+	exts := srtgears.FormatExtensions()
+	for i, ext := range exts {
+		exts[i] = "*" + ext
+	}
+	if len(exts) < 2 {
+		return strings.Join(exts, "")
+	}
+	return strings.Join(exts[:len(exts)-1], ", ") + " or " + exts[len(exts)-1]
+}
+
+// EncList returns the names of the supported character encodings as a human readable list,
+// e.g. "UTF-8, UTF-16LE or Windows-1250".
+func EncList() string {
+	var names []string
+	for _, enc := range srtgears.Encodings() {
+		names = append(names, enc.Name)
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// Encodings returns the character encodings specified by '-inEnc' and '-outEnc'.
+// in is nil if the input encoding is to be detected.
+func (e *Executor) Encodings() (in, out *srtgears.Encoding, err error) {
+	if e.InEnc != "" && !strings.EqualFold(e.InEnc, "auto") {
+		if in = srtgears.EncodingByName(e.InEnc); in == nil {
+			return nil, nil, fmt.Errorf("Unsupported input encoding: %s", e.InEnc)
+		}
+	}
+	out = srtgears.UTF8
+	if e.OutEnc != "" {
+		if out = srtgears.EncodingByName(e.OutEnc); out == nil {
+			return nil, nil, fmt.Errorf("Unsupported output encoding: %s", e.OutEnc)
+		}
+	}
+	return
+}
+
+// ConfigFormat configures a format according to the arguments, for input or for output,
+// e.g. frame based formats get the frame rate specified by '-fps' (in case of 'from:to', from for input, to for output).
+func (e *Executor) ConfigFormat(f srtgears.Format, output bool) srtgears.Format {
+	from, to, _, err := e.frameRates()
+	fps := from
+	if output {
+		fps = to
+	}
+	if fr, ok := f.(srtgears.FrameRater); ok && err == nil && fps > 0 {
+		return fr.WithFrameRate(fps)
+	}
+	return f
+}
+
+// frameRates returns the frame rates specified by '-fps'. from and to are equal if no conversion is specified,
+// and are 0 if '-fps' is not specified.
+func (e *Executor) frameRates() (from, to float64, convert bool, err error) {
+	if e.Fps == "" {
+		return
+	}
+	parts := strings.SplitN(e.Fps, ":", 2)
+	if from, err = srtgears.ParseFrameRate(parts[0]); err != nil {
+		return
+	}
+	if len(parts) == 1 {
+		return from, from, false, nil
+	}
+	if to, err = srtgears.ParseFrameRate(parts[1]); err != nil {
+		return
+	}
+	return from, to, true, nil
+}
+
 // Regexp pattern used to parse timestamps.
 var timestampPattern = regexp.MustCompile(`(\d\d):(\d\d):(\d\d)[,\.](\d\d\d)`)
 
@@ -110,6 +278,157 @@ func parseTime(t string) (time.Duration, error) {
 	return time.Hour*get(1) + time.Minute*get(2) + time.Second*get(3) + time.Millisecond*get(4), nil
 }
 
+// timecodeRate returns the frame rate of SMPTE timecodes in time arguments.
+func (e *Executor) timecodeRate() (float64, error) {
+	if e.TcFps != "" {
+		return srtgears.ParseFrameRate(e.TcFps)
+	}
+	if _, to, _, err := e.frameRates(); err != nil || to != 0 {
+		return to, err
+	}
+	return 0, fmt.Errorf("Frame rate of timecodes must be specified ('-tcFps')!")
+}
+
+// parseTimecode parses a time which is either in the form of 00:00:00,000
+// or a SMPTE timecode such as 01:00:12:14 (or 01:00:12;14 for drop-frame).
+func (e *Executor) parseTimecode(t string) (time.Duration, error) {
+	if !srtgears.IsTimecode(t) {
+		return parseTime(t)
+	}
+	fps, err := e.timecodeRate()
+	if err != nil {
+		return 0, err
+	}
+	tc, err := srtgears.ParseTimecode(t, fps)
+	if err != nil {
+		return 0, err
+	}
+	return tc.Duration(), nil
+}
+
+// parseTimeArg parses a time argument (see parseTimecode()).
+// SMPTE timecodes are relative to the timecode origin ('-tcOrigin').
+func (e *Executor) parseTimeArg(t string) (time.Duration, error) {
+	d, err := e.parseTimecode(t)
+	if err != nil || e.TcOrigin == "" || !srtgears.IsTimecode(t) {
+		return d, err
+	}
+	origin, err := e.parseTimecode(e.TcOrigin)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time for tcOrigin: %s (%v)", e.TcOrigin, err)
+	}
+	return d - origin, nil
+}
+
+// parseTimePair parses 2 time arguments separated by sep, e.g. a time range 'from-to'.
+func (e *Executor) parseTimePair(pair, sep string) (t1, t2 time.Duration, err error) {
+	parts := strings.SplitN(pair, sep, 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Missing '%s': %s", sep, pair)
+	}
+	if t1, err = e.parseTimeArg(parts[0]); err != nil {
+		return
+	}
+	t2, err = e.parseTimeArg(parts[1])
+	return
+}
+
+// formatTime formats a timestamp in the form of
+// 00:00:00,000
+func formatTime(t time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", t/time.Hour, t%time.Hour/time.Minute, t%time.Minute/time.Second, t%time.Second/time.Millisecond)
+}
+
+// lintRules returns the lint rules: the defaults overridden by '-lintRules'.
+func (e *Executor) lintRules() (*srtgears.LintRules, error) {
+	rules := srtgears.DefaultLintRules()
+	if e.LintRules == "" {
+		return rules, nil
+	}
+
+	for _, kv := range strings.Split(e.LintRules, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid lint rule: %s", kv)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid lint rule value: %s", kv)
+		}
+		switch key {
+		case "maxLineLen":
+			rules.MaxLineLen = int(n)
+		case "maxLines":
+			rules.MaxLines = int(n)
+		case "maxCPS":
+			rules.MaxCPS = n
+		case "minDur":
+			rules.MinDuration = time.Duration(n * float64(time.Millisecond))
+		case "maxDur":
+			rules.MaxDuration = time.Duration(n * float64(time.Millisecond))
+		case "minGap":
+			rules.MinGap = time.Duration(n * float64(time.Millisecond))
+		default:
+			return nil, fmt.Errorf("Unknown lint rule: %s", key)
+		}
+	}
+	return rules, nil
+}
+
+// parseSyncPoints parses sync points separated by white space, each in the form of 'from=to',
+// where to is a time argument and from is a time argument or a subtitle number (1-based) of sp in the form of '#12'.
+func (e *Executor) parseSyncPoints(points string, sp *srtgears.SubsPack) (from, to []time.Duration, err error) {
+	for _, point := range strings.Fields(points) {
+		parts := strings.SplitN(point, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("Invalid sync point: %s", point)
+		}
+
+		var a time.Duration
+		if strings.HasPrefix(parts[0], "#") {
+			n, err := strconv.Atoi(parts[0][1:])
+			if err != nil || n < 1 || n > len(sp.Subs) {
+				return nil, nil, fmt.Errorf("Invalid subtitle number in sync point: %s", point)
+			}
+			a = sp.Subs[n-1].TimeIn
+		} else if a, err = e.parseTimeArg(parts[0]); err != nil {
+			return nil, nil, fmt.Errorf("Invalid time in sync point: %s (%v)", point, err)
+		}
+		b, err := e.parseTimeArg(parts[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid time in sync point: %s (%v)", point, err)
+		}
+
+		from, to = append(from, a), append(to, b)
+	}
+	return
+}
+
+// Min confidence of aligning to '-syncTo' or '-syncAudio' to accept it.
+const minSyncToConfidence = 0.25
+
+// Mapping between extrapolations expected in arguments to srtgears.Extrapolation.
+var argExtrapToExtrap = map[string]srtgears.Extrapolation{
+	"shift": srtgears.ExtrapolateShift, "linear": srtgears.ExtrapolateLinear, "none": srtgears.ExtrapolateNone,
+}
+
+// Mapping between overlap strategies expected in arguments to srtgears.OverlapStrategy.
+var argOverlapsToStrategy = map[string]srtgears.OverlapStrategy{
+	"trim": srtgears.OverlapTrim, "shift": srtgears.OverlapShift, "combine": srtgears.OverlapCombine, "stack": srtgears.OverlapStack,
+}
+
+// Mapping between hearing impaired removal modes expected in arguments to our model HIMode.
+var argHIModes = map[string]srtgears.HIMode{
+	"lines": srtgears.HILines, "inline": srtgears.HIInline, "speakers": srtgears.HISpeakers, "music": srtgears.HIMusic,
+	"multiline": srtgears.HIMultiLine, "dashes": srtgears.HIDashes, "all": srtgears.HIAll,
+}
+
+// Mapping between reflow shapes expected in arguments to srtgears.ReflowShape.
+var argReflowToShape = map[string]srtgears.ReflowShape{
+	"": srtgears.ReflowPyramid, "pyramid": srtgears.ReflowPyramid, "bottom": srtgears.ReflowBottomHeavy,
+}
+
 // Mapping between positions expected in arguments to our model Pos.
 var argPosToModelPos = map[string]srtgears.Pos{
 	"TL": srtgears.TopLeft, "T": srtgears.Top, "TR": srtgears.TopRight,
@@ -117,6 +436,37 @@ var argPosToModelPos = map[string]srtgears.Pos{
 	"BL": srtgears.BottomLeft, "B": srtgears.Bottom, "BR": srtgears.BottomRight,
 }
 
+// Regexp pattern of the part number in output file name templates, e.g. '%d' or '%02d'.
+var outTemplatePattern = regexp.MustCompile(`%0?\d*d`)
+
+// Output is an output file to be written after GearIt().
+type Output struct {
+	Name string             // File name
+	Sp   *srtgears.SubsPack // Subtitles to be written
+}
+
+// Outputs returns the output files to be written after GearIt(): '-out' and '-out2',
+// or the parts produced by '-splitAt' if '-out' is a file name template.
+func (e *Executor) Outputs() (outputs []Output) {
+	if len(e.Parts) > 0 && outTemplatePattern.MatchString(e.Out) {
+		for i, sp := range e.Parts {
+			name := outTemplatePattern.ReplaceAllStringFunc(e.Out, func(verb string) string {
+				return fmt.Sprintf(verb, i+1)
+			})
+			outputs = append(outputs, Output{Name: name, Sp: sp})
+		}
+		return
+	}
+
+	if e.Out != "" && e.Sp1 != nil {
+		outputs = append(outputs, Output{Name: e.Out, Sp: e.Sp1})
+	}
+	if e.Out2 != "" && e.Sp2 != nil {
+		outputs = append(outputs, Output{Name: e.Out2, Sp: e.Sp2})
+	}
+	return
+}
+
 // GearIt performs subtitle transformations specified by the arguments passed to ProcFlags().
 // Prior to calling this method, Executor.Sp1 and Executor.Sp2 should be set.
 func (e *Executor) GearIt() (err error) {
@@ -129,10 +479,99 @@ func (e *Executor) GearIt() (err error) {
 		return fmt.Errorf("2nd input file must be specified ('-in2')!")
 	}
 
+	if e.TcOrigin != "" {
+		origin, err := e.parseTimecode(e.TcOrigin)
+		if err != nil {
+			return fmt.Errorf("Invalid time for tcOrigin: %s (%v)", e.TcOrigin, err)
+		}
+		sp1.Rebase(origin)
+		e.Modified = true
+	}
+
+	if e.Sync != "" {
+		from, to, err := e.parseSyncPoints(e.Sync, sp1)
+		if err != nil {
+			return err
+		}
+		if len(from) != 2 {
+			return fmt.Errorf("Exactly 2 sync points must be specified: %s", e.Sync)
+		}
+		if err = sp1.SyncTwoPoints(from[0], from[1], to[0], to[1]); err != nil {
+			return err
+		}
+		e.Modified = true
+	}
+
+	if e.SyncPoints != "" {
+		extrap, ok := argExtrapToExtrap[e.SyncExtrap]
+		if !ok {
+			return fmt.Errorf("Invalid syncExtrap value: %s", e.SyncExtrap)
+		}
+		// Strip off "//" comments
+		lines := strings.Split(string(e.SyncPointsData), "\n")
+		for i, line := range lines {
+			if idx := strings.Index(line, "//"); idx >= 0 {
+				lines[i] = line[:idx]
+			}
+		}
+		from, to, err := e.parseSyncPoints(strings.Join(lines, "\n"), sp1)
+		if err != nil {
+			return err
+		}
+		points := make([]srtgears.SyncPoint, len(from))
+		for i := range from {
+			points[i] = srtgears.SyncPoint{From: from[i], To: to[i]}
+		}
+		if err = sp1.SyncPoints(points, extrap); err != nil {
+			return err
+		}
+		e.Modified = true
+	}
+
+	if e.SyncTo != "" {
+		if e.SpRef == nil {
+			return fmt.Errorf("Reference file must be loaded ('-syncTo')!")
+		}
+		ar, err := sp1.Align(e.SpRef, nil)
+		if err != nil {
+			return err
+		}
+		e.SyncResult = ar
+		if ar.Confidence < minSyncToConfidence {
+			return fmt.Errorf("Failed to align to reference, confidence is too low: %.1f%%", ar.Confidence*100)
+		}
+		if err = sp1.ApplyAlign(ar); err != nil {
+			return err
+		}
+		e.Modified = true
+	}
+
+	if e.SyncAudio != "" {
+		if e.Audio == nil {
+			return fmt.Errorf("Audio file must be loaded ('-syncAudio')!")
+		}
+		// Sync a copy first, only accept it if confident
+		sp := &srtgears.SubsPack{}
+		for _, s := range sp1.Subs {
+			s2 := *s
+			sp.Subs = append(sp.Subs, &s2)
+		}
+		ar, err := audiosync.Sync(sp, e.Audio, nil)
+		if err != nil {
+			return err
+		}
+		e.SyncResult = ar
+		if ar.Confidence < minSyncToConfidence {
+			return fmt.Errorf("Failed to sync to audio, confidence is too low: %.1f%%", ar.Confidence*100)
+		}
+		sp1.Subs = sp.Subs
+		e.Modified = true
+	}
+
 	if e.Concat != "" {
-		secPartStart, err := parseTime(e.Concat)
+		secPartStart, err := e.parseTimeArg(e.Concat)
 		if err != nil {
-			return fmt.Errorf("Invalid time for concat: %s", e.Concat)
+			return fmt.Errorf("Invalid time for concat: %s (%v)", e.Concat, err)
 		}
 		sp1.Concatenate(sp2, secPartStart)
 		e.Modified = true
@@ -154,7 +593,18 @@ func (e *Executor) GearIt() (err error) {
 	}
 
 	if e.RemoveHI {
-		sp1.RemoveHI()
+		modes := srtgears.HILines
+		if e.HIModes != "" {
+			modes = 0
+			for _, name := range strings.Split(e.HIModes, ",") {
+				mode, ok := argHIModes[strings.TrimSpace(name)]
+				if !ok {
+					return fmt.Errorf("Invalid hiModes value: %s", name)
+				}
+				modes |= mode
+			}
+		}
+		sp1.RemoveHIModes(modes)
 		e.Modified = true
 	}
 
@@ -163,6 +613,55 @@ func (e *Executor) GearIt() (err error) {
 		e.Modified = true
 	}
 
+	if e.Replace != "" {
+		rules, err := srtgears.ParseReplaceRules(e.ReplaceData)
+		if err != nil {
+			return err
+		}
+		e.ReplaceCounts = sp1.Replace(rules, e.KeepTags)
+		fmt.Fprintf(e.output, "REPLACE in %s:\n", e.In)
+		for i, rule := range rules {
+			fmt.Fprintf(e.output, "%6d  %v\n", e.ReplaceCounts[i], rule)
+		}
+		e.Modified = true
+	}
+
+	if e.MaxLineLen < 0 {
+		return fmt.Errorf("Invalid maxLineLen value: %d", e.MaxLineLen)
+	}
+	shape, ok := argReflowToShape[e.Reflow]
+	if !ok {
+		return fmt.Errorf("Invalid reflow value: %s", e.Reflow)
+	}
+
+	if e.MergeShort != 0 {
+		if e.MergeShort < 0 {
+			return fmt.Errorf("Invalid mergeShort value: %d", e.MergeShort)
+		}
+		e.ShortMerged = sp1.MergeShort(&srtgears.MergeShortOptions{
+			MaxGap:        time.Duration(e.MergeShort) * time.Millisecond,
+			ShortDuration: time.Duration(e.MinDur) * time.Millisecond,
+			MaxChars:      e.MaxLineLen,
+			MaxLines:      e.MaxLines,
+			Shape:         shape,
+			Dialogue:      e.Dialogue,
+		})
+		e.Modified = true
+	}
+
+	if e.SplitLong {
+		if e.MaxLineLen == 0 && e.MaxDur <= 0 {
+			return fmt.Errorf("'-maxLineLen' or '-maxDur' must be specified for splitLong!")
+		}
+		e.LongSplit = sp1.SplitLong(e.MaxLineLen, e.MaxLines, time.Duration(e.MaxDur)*time.Millisecond)
+		e.Modified = true
+	}
+
+	if e.MaxLineLen != 0 {
+		sp1.Reflow(e.MaxLineLen, e.MaxLines, shape)
+		e.Modified = true
+	}
+
 	if e.Pos != "" {
 		pos2, ok := argPosToModelPos[e.Pos]
 		if !ok {
@@ -177,6 +676,15 @@ func (e *Executor) GearIt() (err error) {
 		e.Modified = true
 	}
 
+	from, to, convert, err := e.frameRates()
+	if err != nil {
+		return err
+	}
+	if convert {
+		sp1.ConvertFrameRate(from, to)
+		e.Modified = true
+	}
+
 	if e.Scale != 0 {
 		sp1.Scale(e.Scale)
 		e.Modified = true
@@ -187,16 +695,138 @@ func (e *Executor) GearIt() (err error) {
 		e.Modified = true
 	}
 
-	if e.SplitAt != "" {
-		at, err := parseTime(e.SplitAt)
+	if e.MinDur < 0 || e.MaxDur < 0 || e.MinGap < 0 || e.MaxDur > 0 && e.MinDur > e.MaxDur {
+		return fmt.Errorf("Invalid minDur, maxDur or minGap values: %d, %d, %d", e.MinDur, e.MaxDur, e.MinGap)
+	}
+
+	if e.Cut != "" {
+		var ranges [][2]time.Duration
+		for _, r := range strings.Fields(e.Cut) {
+			from, to, err := e.parseTimePair(r, "-")
+			if err != nil {
+				return fmt.Errorf("Invalid time range for cut: %s (%v)", r, err)
+			}
+			if to <= from {
+				return fmt.Errorf("Invalid time range for cut: %s", r)
+			}
+			ranges = append(ranges, [2]time.Duration{from, to})
+		}
+		// Cut later ranges first so ranges refer to the original timeline
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] > ranges[j][0] })
+		for i, r := range ranges {
+			if i > 0 && r[1] > ranges[i-1][0] {
+				return fmt.Errorf("Time ranges for cut must not overlap: %s", e.Cut)
+			}
+		}
+		for _, r := range ranges {
+			sp1.Cut(r[0], r[1])
+		}
+		e.Modified = true
+	}
+
+	if e.InsertGap != "" {
+		at, length, err := e.parseTimePair(e.InsertGap, "+")
+		if err != nil {
+			return fmt.Errorf("Invalid value for insertGap: %s (%v)", e.InsertGap, err)
+		}
+		if length <= 0 {
+			return fmt.Errorf("Invalid length for insertGap: %s", e.InsertGap)
+		}
+		sp1.InsertGap(at, length)
+		e.Modified = true
+	}
+
+	if e.Extract != "" {
+		from, to, err := e.parseTimePair(e.Extract, "-")
 		if err != nil {
-			return fmt.Errorf("Invalid time for splitAt: %s", e.SplitAt)
+			return fmt.Errorf("Invalid time range for extract: %s (%v)", e.Extract, err)
+		}
+		if to <= from {
+			return fmt.Errorf("Invalid time range for extract: %s", e.Extract)
 		}
-		sp2 = sp1.Split(at)
+		sp1.Extract(from, to)
+		e.Modified = true
+	}
+
+	if e.Overlaps != "" {
+		strategy, ok := argOverlapsToStrategy[e.Overlaps]
+		if !ok {
+			return fmt.Errorf("Invalid overlaps value: %s", e.Overlaps)
+		}
+		if e.OverlapsFound, err = sp1.ResolveOverlaps(strategy); err != nil {
+			return err
+		}
+		e.Modified = true
+	}
+
+	if e.CPS != 0 || e.WPM != 0 {
+		if e.CPS < 0 || e.WPM < 0 {
+			return fmt.Errorf("Invalid cps or wpm values: %v, %v", e.CPS, e.WPM)
+		}
+		sp1.RetimeByReadingSpeed(&srtgears.ReadingSpeed{CPS: e.CPS, WPM: e.WPM,
+			MinDuration: time.Duration(e.MinDur) * time.Millisecond, MaxDuration: time.Duration(e.MaxDur) * time.Millisecond})
+		e.Modified = true
+	}
+
+	if e.MinDur != 0 || e.MaxDur != 0 || e.MinGap != 0 {
+		sp1.NormalizeTiming(time.Duration(e.MinDur)*time.Millisecond, time.Duration(e.MaxDur)*time.Millisecond,
+			time.Duration(e.MinGap)*time.Millisecond)
+		e.Modified = true
+	}
+
+	if e.FpsSnap {
+		if to == 0 {
+			return fmt.Errorf("Frame rate must be specified for snapping ('-fps')!")
+		}
+		sp1.SnapToFrames(to)
+		e.Modified = true
+	}
+
+	if e.SplitAt != "" {
+		var ats []time.Duration
+		for _, t := range strings.Fields(e.SplitAt) {
+			at, err := e.parseTimeArg(t)
+			if err != nil {
+				return fmt.Errorf("Invalid time for splitAt: %s (%v)", t, err)
+			}
+			if n := len(ats); n > 0 && at <= ats[n-1] {
+				return fmt.Errorf("Times for splitAt must be increasing: %s", e.SplitAt)
+			}
+			ats = append(ats, at)
+		}
+		if len(ats) > 1 && !outTemplatePattern.MatchString(e.Out) {
+			return fmt.Errorf("Output file name template must be specified when splitting at multiple times ('-out', e.g. 'movie.cd%%d.srt')!")
+		}
+		e.Parts = sp1.SplitN(ats, e.SplitClip)
+		sp2 = e.Parts[1]
 		e.Sp2 = sp2 // sp2 is just a local copy, so we need to update Executor.Sp2 too!
 		e.Modified = true
 	}
 
+	if e.Lint {
+		rules, err := e.lintRules()
+		if err != nil {
+			return err
+		}
+		if e.BeforeStats != nil {
+			e.BeforeStats()
+		}
+		errs, warns := 0, 0
+		fmt.Fprintf(e.output, "LINT of %s:\n", e.In)
+		for _, lf := range sp1.Lint(rules) {
+			if lf.Severity == srtgears.SeverityError {
+				errs++
+			} else {
+				warns++
+			}
+			fmt.Fprintf(e.output, "%s %s\n", formatTime(lf.Sub.TimeIn), lf)
+		}
+		fmt.Fprintf(e.output, "%d error(s), %d warning(s)\n", errs, warns)
+		if errs > 0 {
+			return fmt.Errorf("Lint failed: %d error(s) found!", errs)
+		}
+	}
+
 	if e.Stats {
 		if e.BeforeStats != nil {
 			e.BeforeStats()
@@ -228,7 +858,7 @@ func (e *Executor) GearIt() (err error) {
 		if e.Out == "" {
 			return fmt.Errorf("Output file must be specified ('-out')!")
 		}
-		if e.SplitAt != "" && e.Out2 == "" {
+		if e.SplitAt != "" && e.Out2 == "" && !outTemplatePattern.MatchString(e.Out) {
 			return fmt.Errorf("Second output file must be specified ('-out2')!")
 		}
 	}
@@ -0,0 +1,288 @@
+/*
+
+This file defines the Format type which describes a subtitle file format,
+and the format registry which holds the known formats.
+
+Built-in formats are registered by default, third-party packages may register
+their own formats with RegisterFormat(), usually from an init() function.
+
+*/
+
+package srtgears
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Format is a subtitle file format.
+type Format interface {
+	// Name returns the name of the format, e.g. "SubRip".
+	Name() string
+
+	// Extensions returns the file name extensions of the format in lower case,
+	// with leading dot, e.g. ".srt".
+	Extensions() []string
+
+	// Read reads and parses subtitles in this format from an io.Reader and builds the model from it.
+	Read(r io.Reader) (*SubsPack, error)
+
+	// Write generates subtitles in this format and writes it to an io.Writer.
+	Write(w io.Writer, sp *SubsPack) error
+
+	// Sniff tells if the data (beginning of a file) looks like to be in this format.
+	Sniff(data []byte) bool
+}
+
+// FrameRater is implemented by frame based formats,
+// which need a frame rate to convert frame numbers to timestamps and back.
+type FrameRater interface {
+	// WithFrameRate returns a Format which uses the given frame rate.
+	// When reading, it is only used if the input does not specify it.
+	WithFrameRate(fps float64) Format
+}
+
+// Built-in formats, registered by default.
+var (
+	SubRip                  Format = srtFormat{}
+	SubStationAlpha         Format = ssaFormat{}
+	AdvancedSubStationAlpha Format = assFormat{}
+	WebVTT                  Format = vttFormat{}
+	TTML                    Format = ttmlFormat{}
+	MicroDVD                Format = microDVDFormat{}
+)
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+func init() {
+	// Order matters when sniffing: formats registered later are tried first, so more specific formats come last.
+	for _, f := range []Format{SubRip, MicroDVD, SubStationAlpha, AdvancedSubStationAlpha, TTML, WebVTT} {
+		RegisterFormat(f)
+	}
+}
+
+// RegisterFormat registers a subtitle format.
+// Formats registered later take precedence when looking up by extension and when sniffing.
+// Panics if a format with the same name is already registered.
+func RegisterFormat(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	for _, f2 := range formats {
+		if f2.Name() == f.Name() {
+			panic("srtgears: RegisterFormat called twice for format " + f.Name())
+		}
+	}
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats, in order of precedence.
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	fs := make([]Format, len(formats))
+	for i, f := range formats {
+		fs[len(fs)-1-i] = f
+	}
+	return fs
+}
+
+// FormatExtensions returns the file name extensions of all registered formats, in order of registration.
+func FormatExtensions() (exts []string) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for _, f := range formats {
+		exts = append(exts, f.Extensions()...)
+	}
+	return
+}
+
+// FormatByExt returns the format registered for the given file name extension
+// (case insensitive, with leading dot, e.g. ".srt").
+// Returns nil if no format is registered for the extension.
+func FormatByExt(ext string) Format {
+	ext = strings.ToLower(ext)
+	for _, f := range Formats() {
+		for _, ext2 := range f.Extensions() {
+			if ext == ext2 {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Max length of data passed to Format.Sniff().
+const sniffLen = 4096
+
+// SniffFormat returns the first format which recognizes the data (beginning of a file).
+// Returns nil if the data is not recognized.
+func SniffFormat(data []byte) Format {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Strip off BOM
+	for _, f := range Formats() {
+		if f.Sniff(data) {
+			return f
+		}
+	}
+	return nil
+}
+
+// DetectFormat returns the format of a subtitle file. It is chosen by the extension of the file name,
+// or if the extension is unknown, by the content (data may be nil if it's unknown).
+// Returns nil if format cannot be detected.
+func DetectFormat(name string, data []byte) Format {
+	if f := FormatByExt(filepath.Ext(name)); f != nil {
+		return f
+	}
+	if data != nil {
+		return SniffFormat(data)
+	}
+	return nil
+}
+
+// ReadFile reads and parses a subtitle file and builds the model from it.
+// The encoding is chosen by DetectEncoding(), the format is chosen by DetectFormat().
+func ReadFile(name string) (sp *SubsPack, err error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+
+	debugf("Reading from file: %s", name)
+	return readFormat(bytes.NewReader(data), name, data)
+}
+
+// ReadFrom reads and parses subtitles from an io.Reader and builds the model from it.
+// name is the (original) file name. The encoding is chosen by DetectEncoding(),
+// the format is chosen by DetectFormat().
+func ReadFrom(r io.Reader, name string) (sp *SubsPack, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	return readFormat(bytes.NewReader(data), name, data)
+}
+
+// readFormat detects the encoding and the format, and reads subtitles using it.
+func readFormat(r io.Reader, name string, data []byte) (*SubsPack, error) {
+	data, enc := ToUTF8(data, nil)
+	if enc != UTF8 {
+		debugf("Encoding: %s", enc)
+		r = bytes.NewReader(data)
+	}
+
+	f := DetectFormat(name, data)
+	if f == nil {
+		return nil, fmt.Errorf("Unknown subtitle format: %s", name)
+	}
+	debugf("Format: %s", f.Name())
+	return f.Read(r)
+}
+
+// WriteFile generates subtitles and writes it to a file.
+// The format is chosen by the extension of the file name.
+func WriteFile(name string, sp *SubsPack) (err error) {
+	f := FormatByExt(filepath.Ext(name))
+	if f == nil {
+		return fmt.Errorf("Unknown subtitle format: %s", name)
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	debugf("Writing %d subtitles to file: %s", len(sp.Subs), name)
+	return f.Write(file, sp)
+}
+
+// WriteTo generates subtitles and writes it to an io.Writer.
+// name is the file name, the format is chosen by its extension.
+func WriteTo(w io.Writer, name string, sp *SubsPack) error {
+	f := FormatByExt(filepath.Ext(name))
+	if f == nil {
+		return fmt.Errorf("Unknown subtitle format: %s", name)
+	}
+	return f.Write(w, sp)
+}
+
+// Patterns used when sniffing.
+var (
+	srtSniffPattern      = regexp.MustCompile(`(?m)^\s*\d+\s*\r?\n` + timestampsPattern.String())
+	ssaSniffPattern      = regexp.MustCompile(`(?im)^\[(script info|v4 styles)\]`)
+	assSniffPattern      = regexp.MustCompile(`(?im)^(\[v4\+ styles\]|scripttype:\s*v4\.00\+)`)
+	ttmlSniffPattern     = regexp.MustCompile(`<(\w+:)?tt[\s>]`)
+	microDVDSniffPattern = regexp.MustCompile(`^\s*{\d+}{\d*}`)
+)
+
+// srtFormat is the SubRip format.
+type srtFormat struct{}
+
+func (srtFormat) Name() string                          { return "SubRip" }
+func (srtFormat) Extensions() []string                  { return []string{".srt"} }
+func (srtFormat) Read(r io.Reader) (*SubsPack, error)   { return ReadSrtFrom(r) }
+func (srtFormat) Write(w io.Writer, sp *SubsPack) error { return WriteSrtTo(w, sp) }
+func (srtFormat) Sniff(data []byte) bool                { return srtSniffPattern.Match(data) }
+
+// ssaFormat is the Sub Station Alpha format.
+type ssaFormat struct{}
+
+func (ssaFormat) Name() string                          { return "Sub Station Alpha" }
+func (ssaFormat) Extensions() []string                  { return []string{".ssa"} }
+func (ssaFormat) Read(r io.Reader) (*SubsPack, error)   { return ReadSsaFrom(r) }
+func (ssaFormat) Write(w io.Writer, sp *SubsPack) error { return WriteSsaTo(w, sp) }
+func (ssaFormat) Sniff(data []byte) bool                { return ssaSniffPattern.Match(data) }
+
+// assFormat is the Advanced Sub Station Alpha format.
+type assFormat struct{}
+
+func (assFormat) Name() string                          { return "Advanced Sub Station Alpha" }
+func (assFormat) Extensions() []string                  { return []string{".ass"} }
+func (assFormat) Read(r io.Reader) (*SubsPack, error)   { return ReadAssFrom(r) }
+func (assFormat) Write(w io.Writer, sp *SubsPack) error { return WriteAssTo(w, sp) }
+func (assFormat) Sniff(data []byte) bool                { return assSniffPattern.Match(data) }
+
+// vttFormat is the WebVTT format.
+type vttFormat struct{}
+
+func (vttFormat) Name() string                          { return "WebVTT" }
+func (vttFormat) Extensions() []string                  { return []string{".vtt"} }
+func (vttFormat) Read(r io.Reader) (*SubsPack, error)   { return ReadVttFrom(r) }
+func (vttFormat) Write(w io.Writer, sp *SubsPack) error { return WriteVttTo(w, sp) }
+func (vttFormat) Sniff(data []byte) bool                { return bytes.HasPrefix(data, []byte("WEBVTT")) }
+
+// ttmlFormat is the Timed Text Markup Language format.
+type ttmlFormat struct{}
+
+func (ttmlFormat) Name() string                          { return "TTML" }
+func (ttmlFormat) Extensions() []string                  { return []string{".ttml", ".dfxp"} }
+func (ttmlFormat) Read(r io.Reader) (*SubsPack, error)   { return ReadTtmlFrom(r) }
+func (ttmlFormat) Write(w io.Writer, sp *SubsPack) error { return WriteTtmlTo(w, sp) }
+func (ttmlFormat) Sniff(data []byte) bool                { return ttmlSniffPattern.Match(data) }
+
+// microDVDFormat is the MicroDVD format.
+type microDVDFormat struct {
+	fps float64 // Frame rate, when reading only used if not specified by the input
+}
+
+func (microDVDFormat) Name() string                            { return "MicroDVD" }
+func (microDVDFormat) Extensions() []string                    { return []string{".sub"} }
+func (f microDVDFormat) Read(r io.Reader) (*SubsPack, error)   { return ReadMicroDVDFrom(r, f.fps) }
+func (f microDVDFormat) Write(w io.Writer, sp *SubsPack) error { return WriteMicroDVDTo(w, sp, f.fps) }
+func (microDVDFormat) Sniff(data []byte) bool                  { return microDVDSniffPattern.Match(data) }
+func (microDVDFormat) WithFrameRate(fps float64) Format        { return microDVDFormat{fps: fps} }
@@ -0,0 +1,94 @@
+/*
+
+This file implements frame rate conversion and snapping timestamps to frames.
+
+When a movie is converted to another frame rate by changing its playback speed (e.g. PAL speedup:
+a 23.976 fps film played at 25 fps), all timestamps change by the ratio of the frame rates.
+Converting subtitles timed for a 25 fps version to a 23.976 fps version means multiplying
+timestamps by 25/23.976.
+
+The NTSC rates (23.976, 29.97, 59.94) are not exact decimals, they are 24000/1001, 30000/1001
+and 60000/1001; ParseFrameRate() returns the exact values for them.
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Common video frame rates.
+const (
+	FrameRate23976 = 24000.0 / 1001 // NTSC film
+	FrameRate24    = 24.0           // Film
+	FrameRate25    = 25.0           // PAL
+	FrameRate2997  = 30000.0 / 1001 // NTSC
+	FrameRate30    = 30.0
+	FrameRate50    = 50.0           // PAL interlaced fields / HD
+	FrameRate5994  = 60000.0 / 1001 // NTSC interlaced fields / HD
+)
+
+// Named frame rate presets, accepted by ParseFrameRate().
+var frameRatePresets = map[string]float64{
+	"23.976": FrameRate23976, "23.98": FrameRate23976, "ntsc-film": FrameRate23976,
+	"24": FrameRate24, "film": FrameRate24,
+	"25": FrameRate25, "pal": FrameRate25,
+	"29.97": FrameRate2997, "ntsc": FrameRate2997,
+	"30":    FrameRate30,
+	"50":    FrameRate50,
+	"59.94": FrameRate5994,
+}
+
+// ParseFrameRate parses a frame rate, which may be a preset (e.g. "23.976" which is 24000/1001,
+// "25" or "pal"), a number (e.g. "12.5") or a fraction (e.g. "30000/1001").
+func ParseFrameRate(s string) (fps float64, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if fps, ok := frameRatePresets[s]; ok {
+		return fps, nil
+	}
+
+	if parts := strings.SplitN(s, "/", 2); len(parts) == 2 {
+		num, err1 := strconv.ParseFloat(parts[0], 64)
+		den, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 == nil && err2 == nil && den > 0 {
+			fps = num / den
+		} else {
+			err = fmt.Errorf("Invalid frame rate: %s", s)
+		}
+	} else if fps, err = strconv.ParseFloat(s, 64); err != nil {
+		err = fmt.Errorf("Invalid frame rate: %s", s)
+	}
+	if err == nil && fps <= 0 {
+		err = fmt.Errorf("Frame rate must be positive: %s", s)
+	}
+	return
+}
+
+// ConvertFrameRate converts the subtitles timed for a video of frame rate from
+// to a video of frame rate to (played at a different speed), e.g. from 25 (PAL) to 23.976 (NTSC film).
+// Both TimeIn and TimeOut are converted (so display durations change too).
+// from and to must be positive.
+func (sp *SubsPack) ConvertFrameRate(from, to float64) {
+	factor := from / to
+	for _, s := range sp.Subs {
+		s.mapTimes(func(t time.Duration) time.Duration {
+			return time.Duration(float64(t) * factor)
+		})
+	}
+	if sp.FrameRate != 0 {
+		sp.FrameRate = to
+	}
+}
+
+// SnapToFrames snaps all timestamps to the nearest frame boundary of the given frame rate,
+// so they line up with frame accurate editors. fps must be positive.
+func (sp *SubsPack) SnapToFrames(fps float64) {
+	for _, s := range sp.Subs {
+		s.TimeIn = framesToDuration(durationToFrames(s.TimeIn, fps), fps)
+		s.TimeOut = framesToDuration(durationToFrames(s.TimeOut, fps), fps)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+
+This file implements removing hearing impaired (HI) text from subtitles.
+
+By default only whole lines in brackets are removed (such as "[PHONE RINGING]" or "(phone ringing)").
+Further modes can be enabled to remove cues inside lines ("[door slams] Get down!"), speaker labels
+("JOHN: Hello"), music ("♪ lyrics ♪") and cues spanning multiple lines, and to clean up the dash
+of a dialogue which lost one of its sides.
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HIMode is a set of hearing impaired removal modes (bit mask of the HI constants).
+type HIMode int
+
+// Hearing impaired removal modes.
+const (
+	// HILines removes whole lines in brackets, e.g. "[PHONE RINGING]" or "(phone ringing)". This is the default.
+	HILines HIMode = 1 << iota
+	// HIInline removes cues in brackets inside lines, e.g. "[door slams] Get down!".
+	HIInline
+	// HISpeakers strips speaker labels at the beginning of lines, e.g. "JOHN: Hello".
+	HISpeakers
+	// HIMusic removes music (text between music notes, and lines having music notes), e.g. "♪ lyrics ♪".
+	HIMusic
+	// HIMultiLine removes cues in brackets spanning multiple lines.
+	HIMultiLine
+	// HIDashes removes the dash of a dialogue which lost one of its sides, e.g. "- (gasps)" and "- Hello" becomes "Hello".
+	// Lines in brackets are also recognized after a dialogue dash.
+	HIDashes
+
+	// HIAll is all the modes.
+	HIAll = HILines | HIInline | HISpeakers | HIMusic | HIMultiLine | HIDashes
+)
+
+// Names of the hearing impaired removal modes.
+var hiModeNames = []struct {
+	mode HIMode
+	name string
+}{
+	{HILines, "lines"},
+	{HIInline, "inline"},
+	{HISpeakers, "speakers"},
+	{HIMusic, "music"},
+	{HIMultiLine, "multiline"},
+	{HIDashes, "dashes"},
+}
+
+// String returns the names of the modes in the set, separated by commas.
+func (m HIMode) String() string {
+	var names []string
+	for _, mn := range hiModeNames {
+		if m&mn.mode != 0 {
+			names = append(names, mn.name)
+			m &^= mn.mode
+		}
+	}
+	if m != 0 {
+		names = append(names, fmt.Sprintf("HIMode(%d)", int(m)))
+	}
+	return strings.Join(names, ",")
+}
+
+// Prefix of lines: white space, formatting and controls.
+const hiLinePrefix = `(?:\s|<[^>]*>|{[^}]*})*`
+
+// Regexp pattern of cues in brackets inside lines.
+var hiInlinePattern = regexp.MustCompile(`\[[^\[\]\n]*\]|\([^()\n]*\)`)
+
+// Regexp pattern of cues in brackets spanning multiple lines.
+var hiMultiLinePattern = regexp.MustCompile(`\[[^\[\]]*\n[^\[\]]*\]|\([^()]*\n[^()]*\)`)
+
+// Regexp pattern of speaker labels at the beginning of lines (uppercase names followed by a colon), e.g. "JOHN:" or "MAN 2:".
+var hiSpeakerPattern = regexp.MustCompile(`^(` + hiLinePrefix + `-?\s*)\p{Lu}[\p{Lu}\d .'-]*:(?:\s+|$)`)
+
+// Regexp pattern of music: text between music notes.
+var hiMusicPattern = regexp.MustCompile(`[♪♫][^♪♫]*[♪♫]`)
+
+// Regexp pattern of the dialogue dash at the beginning of lines.
+var hiDashPattern = regexp.MustCompile(`^(` + hiLinePrefix + `)-\s*`)
+
+// Regexp pattern of formatting left empty.
+var emptyFormatPattern = regexp.MustCompile(`(?i)<\s*(?:i|b|u|font)\b[^>]*>\s*<\s*/\s*(?:i|b|u|font)\s*>`)
+
+// Regexp pattern of repeated spaces.
+var multiSpacePattern = regexp.MustCompile(`  +`)
+
+// isHILine tells if the line (without formatting) is in brackets.
+func isHILine(line string) bool {
+	if len(line) == 0 {
+		return false
+	}
+	first, last := line[0], line[len(line)-1]
+	return first == '[' && last == ']' || first == '(' && last == ')'
+}
+
+// RemoveHIModes removes hearing impaired text using the given modes (see HIMode).
+// Lines left empty are removed.
+// Returns true if HI text was present.
+func (s *Subtitle) RemoveHIModes(modes HIMode) (removed bool) {
+	wasDialogue := s.isDialogue()
+
+	lines := s.Lines
+	if modes&HILines != 0 {
+		lines = nil
+		for _, line := range s.Lines {
+			// Check without HTML formatting to recognize and remove these:
+			// "<i>[PHONE RINGING]</i>"
+			if isHILine(htmlPattern.ReplaceAllString(line, "")) {
+				removed = true
+				continue
+			}
+			if plain := strings.TrimSpace(plainText(line)); modes&HIDashes != 0 &&
+				strings.HasPrefix(plain, "-") && isHILine(strings.TrimSpace(plain[1:])) {
+				removed = true
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	if modes&(HIInline|HISpeakers|HIMusic|HIMultiLine) != 0 {
+		// Lines may contain line breaks: process the physical lines, remembering the line they belong to
+		var origs []string
+		var owners []int
+		for i, line := range lines {
+			for _, orig := range strings.Split(line, "\n") {
+				origs, owners = append(origs, orig), append(owners, i)
+			}
+		}
+
+		// Multi-line removals keep the line breaks so physical lines remain aligned with the original ones
+		removeKeepLines := func(text string, pattern *regexp.Regexp) string {
+			return pattern.ReplaceAllStringFunc(text, func(m string) string {
+				return strings.Repeat("\n", strings.Count(m, "\n"))
+			})
+		}
+		text := strings.Join(origs, "\n")
+		if modes&HIMultiLine != 0 {
+			text = removeKeepLines(text, hiMultiLinePattern)
+		}
+		if modes&HIMusic != 0 {
+			text = removeKeepLines(text, hiMusicPattern)
+		}
+
+		results := make([][]string, len(lines)) // Remaining physical lines of the lines
+		for j, line := range strings.Split(text, "\n") {
+			if origs[j] == "" {
+				results[owners[j]] = append(results[owners[j]], line) // Keep empty lines as they were
+				continue
+			}
+			if modes&HIMusic != 0 && strings.ContainsAny(plainText(line), "♪♫") {
+				removed = true
+				continue
+			}
+			if modes&HIInline != 0 {
+				line = hiInlinePattern.ReplaceAllString(line, "")
+			}
+			if modes&HISpeakers != 0 {
+				line = hiSpeakerPattern.ReplaceAllString(line, "$1")
+			}
+
+			if line != origs[j] {
+				removed = true
+				line = strings.TrimSpace(multiSpacePattern.ReplaceAllString(emptyFormatPattern.ReplaceAllString(line, ""), " "))
+				// Lines left without text (maybe a dialogue dash) are removed
+				if plain := strings.TrimSpace(plainText(line)); plain == "" || plain == "-" {
+					continue
+				}
+			}
+			results[owners[j]] = append(results[owners[j]], line)
+		}
+
+		lines = nil
+		for _, result := range results {
+			if len(result) > 0 {
+				lines = append(lines, strings.Join(result, "\n"))
+			}
+		}
+	}
+	s.Lines = lines
+
+	if modes&HIDashes != 0 && wasDialogue {
+		dashes := 0
+		for _, line := range s.plainLines() {
+			if strings.HasPrefix(strings.TrimSpace(line), "-") {
+				dashes++
+			}
+		}
+		if dashes == 1 {
+			// Only 1 side of the dialogue remained
+			for i, line := range s.Lines {
+				s.Lines[i] = hiDashPattern.ReplaceAllString(line, "$1")
+			}
+		}
+	}
+	return
+}
+
+// RemoveHIModes removes hearing impaired text from subtitles using the given modes (see HIMode).
+// Subtitles left without lines are removed.
+func (sp *SubsPack) RemoveHIModes(modes HIMode) {
+	for i := len(sp.Subs) - 1; i >= 0; i-- {
+		s := sp.Subs[i]
+		s.RemoveHIModes(modes)
+		if len(s.Lines) == 0 {
+			// Can be removed completely
+			sp.Subs = append(sp.Subs[:i], sp.Subs[i+1:]...)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+/*
+
+This file implements quality control checks of subtitle packs (linting).
+
+Checked rules:
+ - max characters per line, max lines per subtitle (formatting and controls are not counted);
+ - max reading speed (characters per second, spaces included, line breaks excluded);
+ - min and max display duration, min gap between subsequent subtitles of the same track;
+ - overlapping subtitles of the same track (subtitles at different positions, e.g. merged dual subs,
+   are different tracks; not specified position is bottom);
+ - negative or zero display duration, empty subtitles;
+ - unbalanced formatting tags (<i>, <b>, <u>, <font>).
+
+Rules having limits are reported as warnings, and can be disabled by using zero limits.
+The others are always checked and are reported as errors.
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// LintRules configures the limits checked by Lint(). Zero values disable the checks.
+type LintRules struct {
+	MaxLineLen  int           // Max characters per line
+	MaxLines    int           // Max lines per subtitle
+	MaxCPS      float64       // Max reading speed, in characters per second
+	MinDuration time.Duration // Min display duration
+	MaxDuration time.Duration // Max display duration
+	MinGap      time.Duration // Min gap between subsequent subtitles
+}
+
+// DefaultLintRules returns the commonly used limits of subtitling guidelines.
+func DefaultLintRules() *LintRules {
+	return &LintRules{
+		MaxLineLen:  42,
+		MaxLines:    2,
+		MaxCPS:      21,
+		MinDuration: 833 * time.Millisecond, // 5/6 second, 20 frames at 24 fps
+		MaxDuration: 7 * time.Second,
+		MinGap:      83 * time.Millisecond, // 2 frames at 24 fps
+	}
+}
+
+// Severity is the severity of a lint finding.
+type Severity int
+
+// Severities of lint findings.
+const (
+	SeverityWarning Severity = iota // Violates a guideline, but the subtitles are usable
+	SeverityError                   // Subtitles are broken
+)
+
+// String returns the name of the severity.
+func (sv Severity) String() string {
+	if sv == SeverityError {
+		return "ERROR"
+	}
+	return "WARNING"
+}
+
+// LintCheck identifies a check performed by Lint().
+type LintCheck int
+
+// Checks performed by Lint().
+const (
+	CheckLineLen       LintCheck = iota // Line too long
+	CheckLines                          // Too many lines
+	CheckCPS                            // Reading speed too high
+	CheckMinDuration                    // Display duration too short
+	CheckMaxDuration                    // Display duration too long
+	CheckMinGap                         // Gap to next subtitle too short
+	CheckOverlap                        // Overlaps next subtitle
+	CheckDuration                       // Negative or zero display duration
+	CheckEmpty                          // Empty subtitle
+	CheckUnbalancedTag                  // Unbalanced formatting tag
+)
+
+// Human readable names of the checks.
+var lintCheckNames = map[LintCheck]string{
+	CheckLineLen:       "line too long",
+	CheckLines:         "too many lines",
+	CheckCPS:           "reading speed too high",
+	CheckMinDuration:   "duration too short",
+	CheckMaxDuration:   "duration too long",
+	CheckMinGap:        "gap too short",
+	CheckOverlap:       "overlap",
+	CheckDuration:      "non-positive duration",
+	CheckEmpty:         "empty subtitle",
+	CheckUnbalancedTag: "unbalanced tag",
+}
+
+// String returns the human readable name of the check.
+func (c LintCheck) String() string {
+	if name, ok := lintCheckNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("LintCheck(%d)", int(c))
+}
+
+// LintFinding is a problem found by Lint().
+type LintFinding struct {
+	Index    int       // Index of the subtitle in SubsPack.Subs
+	Sub      *Subtitle // The subtitle
+	Severity Severity  // Severity of the problem
+	Check    LintCheck // Check that found the problem
+	Msg      string    // Details of the problem
+}
+
+// String returns a human readable description of the finding.
+func (lf LintFinding) String() string {
+	return fmt.Sprintf("#%d: %s: %s: %s", lf.Index+1, lf.Severity, lf.Check, lf.Msg)
+}
+
+// LintError is returned by Validate() if errors are found.
+type LintError struct {
+	Findings []LintFinding // Findings having error severity
+}
+
+// Error implements the error interface.
+func (le *LintError) Error() string {
+	msgs := make([]string, len(le.Findings))
+	for i, lf := range le.Findings {
+		msgs[i] = lf.String()
+	}
+	return fmt.Sprintf("Subtitles are invalid, %d error(s) found: %s", len(le.Findings), strings.Join(msgs, "; "))
+}
+
+// Lint checks the subtitles against the rules and returns the findings, ordered by subtitle.
+// If rules is nil, only the checks without limits are performed.
+// Subtitles should be sorted (as done by the readers).
+func (sp *SubsPack) Lint(rules *LintRules) (findings []LintFinding) {
+	if rules == nil {
+		rules = &LintRules{}
+	}
+
+	// Overlaps and gaps are checked in time order (subtitles may not be sorted)
+	order := make([]int, len(sp.Subs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return sp.Subs[order[a]].TimeIn < sp.Subs[order[b]].TimeIn })
+	type overlap struct {
+		index int           // Index of the overlapping later subtitle
+		dur   time.Duration // Duration of the overlap
+	}
+	overlaps := make([][]overlap, len(sp.Subs))
+	gaps := make([]time.Duration, len(sp.Subs)) // Gap to the next subtitle of the same track, -1 if overlapping or last
+	for k, i := range order {
+		s := sp.Subs[i]
+		gaps[i] = -1
+		for _, j := range order[k+1:] {
+			if next := sp.Subs[j]; trackPos(next.Pos) == trackPos(s.Pos) {
+				if gap := next.TimeIn - s.TimeOut; gap >= 0 {
+					gaps[i] = gap
+				}
+				break
+			}
+		}
+		for _, j := range order[k+1:] {
+			next := sp.Subs[j]
+			if next.TimeIn >= s.TimeOut {
+				break
+			}
+			end := s.TimeOut
+			if next.TimeOut < end {
+				end = next.TimeOut
+			}
+			if end > next.TimeIn && trackPos(next.Pos) == trackPos(s.Pos) {
+				overlaps[i] = append(overlaps[i], overlap{j, end - next.TimeIn})
+			}
+		}
+	}
+
+	for i, s := range sp.Subs {
+		add := func(sv Severity, c LintCheck, format string, a ...interface{}) {
+			findings = append(findings, LintFinding{Index: i, Sub: s, Severity: sv, Check: c, Msg: fmt.Sprintf(format, a...)})
+		}
+
+		chars := 0
+		lines := s.plainLines()
+		for j, line := range lines {
+			n := utf8.RuneCountInString(line)
+			chars += n
+			if rules.MaxLineLen > 0 && n > rules.MaxLineLen {
+				add(SeverityWarning, CheckLineLen, "line %d has %d characters (max %d)", j+1, n, rules.MaxLineLen)
+			}
+		}
+		if strings.TrimSpace(strings.Join(lines, "")) == "" {
+			add(SeverityError, CheckEmpty, "no text")
+		}
+		if rules.MaxLines > 0 && len(lines) > rules.MaxLines {
+			add(SeverityWarning, CheckLines, "%d lines (max %d)", len(lines), rules.MaxLines)
+		}
+
+		dur := s.DisplayDuration()
+		if dur <= 0 {
+			add(SeverityError, CheckDuration, "display duration is %v", dur)
+		} else {
+			if rules.MaxCPS > 0 {
+				if cps := float64(chars) / dur.Seconds(); cps > rules.MaxCPS {
+					add(SeverityWarning, CheckCPS, "%.1f characters per second (max %.1f)", cps, rules.MaxCPS)
+				}
+			}
+			if rules.MinDuration > 0 && dur < rules.MinDuration {
+				add(SeverityWarning, CheckMinDuration, "displayed for %v (min %v)", dur, rules.MinDuration)
+			}
+			if rules.MaxDuration > 0 && dur > rules.MaxDuration {
+				add(SeverityWarning, CheckMaxDuration, "displayed for %v (max %v)", dur, rules.MaxDuration)
+			}
+		}
+
+		for _, o := range overlaps[i] {
+			add(SeverityError, CheckOverlap, "overlaps #%d by %v", o.index+1, o.dur)
+		}
+		if gap := gaps[i]; gap >= 0 && rules.MinGap > 0 && gap < rules.MinGap {
+			add(SeverityWarning, CheckMinGap, "gap to next subtitle is %v (min %v)", gap, rules.MinGap)
+		}
+
+		if msg := unbalancedTag(s.Lines); msg != "" {
+			add(SeverityError, CheckUnbalancedTag, "%s", msg)
+		}
+	}
+
+	return
+}
+
+// unbalancedTag checks if formatting tags are balanced in the lines.
+// Returns a description of the first problem, or an empty string if tags are balanced.
+func unbalancedTag(lines []string) string {
+	var open []string // Stack of open tags
+	for _, line := range lines {
+		for _, tag := range htmlPattern.FindAllString(line, -1) {
+			parts := formatTagPattern.FindStringSubmatch(tag)
+			if len(parts) == 0 {
+				continue
+			}
+			name := strings.ToLower(parts[2])
+			if parts[1] != "/" {
+				open = append(open, name)
+				continue
+			}
+			if len(open) == 0 {
+				return fmt.Sprintf("%s closed but not opened", tag)
+			}
+			if last := open[len(open)-1]; last != name {
+				return fmt.Sprintf("%s closed but <%s> is open", tag, last)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Sprintf("<%s> not closed", open[len(open)-1])
+	}
+	return ""
+}
+
+// Validate checks the subtitles against the rules (see Lint()).
+// Returns a *LintError if errors are found, warnings are not reported.
+func (sp *SubsPack) Validate(rules *LintRules) error {
+	var errs []LintFinding
+	for _, lf := range sp.Lint(rules) {
+		if lf.Severity == SeverityError {
+			errs = append(errs, lf)
+		}
+	}
+	if len(errs) > 0 {
+		return &LintError{Findings: errs}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package srtgears
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLintTracks(t *testing.T) {
+	// Tracks of merged dual subtitles are checked separately
+	sp := &SubsPack{Subs: []*Subtitle{timedSub(1, 3.1, "a"), timedSub(3.05, 4, "b"), timedSub(4.05, 5, "c")}}
+	sp.Merge(&SubsPack{Subs: []*Subtitle{timedSub(2, 3, "top"), timedSub(3.5, 5, "top2")}})
+
+	var got []string
+	for _, lf := range sp.Lint(&LintRules{MinGap: 100 * time.Millisecond}) {
+		got = append(got, lf.Sub.Lines[0]+": "+lf.Msg)
+	}
+	exp := []string{
+		"a: overlaps #3 by 50ms",
+		"b: gap to next subtitle is 50ms (min 100ms)",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %v, got: %v", exp, got)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+
+This file implements merging consecutive short subtitles (e.g. of fast dialogue) into one.
+
+Adjacent subtitles are merged if the gap between them is small, one of them is displayed shortly,
+and the combined text fits the line length and line count limits (the text is re-broken if needed,
+see Subtitle.Reflow()). Merged subtitles can optionally be formatted as a two-speaker dialogue:
+one line per subtitle with leading dashes.
+
+*/
+
+package srtgears
+
+import (
+	"strings"
+	"time"
+)
+
+// MergeShortOptions specifies which subtitles are merged and how (see MergeShort()).
+type MergeShortOptions struct {
+	MaxGap        time.Duration // Subtitles are merged if the gap between them is less than this
+	ShortDuration time.Duration // Subtitles are merged if one of them is displayed shorter than this, 0 if all are merged
+
+	MaxChars int         // Max line length of the merged text (formatting excluded), 0 if not limited
+	MaxLines int         // Max number of lines of the merged text, 0 if not limited
+	Shape    ReflowShape // Shape of the lines if the merged text is re-broken
+
+	Dialogue bool // Format merged subtitles as a two-speaker dialogue (one line per subtitle with leading dashes)
+}
+
+// fits tells if the lines fit the line length and line count limits.
+func (opts *MergeShortOptions) fits(lines []string) bool {
+	if opts.MaxLines > 0 && len(lines) > opts.MaxLines {
+		return false
+	}
+	if opts.MaxChars > 0 {
+		for _, line := range lines {
+			if visibleWidth(line) > opts.MaxChars {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mergedLines returns the lines of s merged into prev, and true if they can be merged.
+func (opts *MergeShortOptions) mergedLines(prev, s *Subtitle) ([]string, bool) {
+	if opts.Dialogue {
+		// Dialogues can't be extended with a third speaker
+		if prev.isDialogue() || s.isDialogue() {
+			return nil, false
+		}
+		lines := []string{dialogueLine(prev.Lines), dialogueLine(s.Lines)}
+		return lines, opts.fits(lines)
+	}
+
+	lines := append(append([]string{}, prev.Lines...), s.Lines...)
+	if opts.fits(lines) {
+		return lines, true
+	}
+	if opts.MaxChars <= 0 || prev.isDialogue() || s.isDialogue() {
+		return nil, false
+	}
+	// Try to re-break the combined text
+	merged := &Subtitle{Lines: lines}
+	if !merged.Reflow(opts.MaxChars, opts.MaxLines, opts.Shape) {
+		return nil, false
+	}
+	return merged.Lines, true
+}
+
+// dialogueLine returns the lines joined into a dialogue line with a leading dash.
+func dialogueLine(lines []string) string {
+	text := strings.TrimSpace(rejoinTagsReplacer.Replace(strings.Join(lines, " ")))
+	return "- " + strings.TrimSpace(strings.TrimPrefix(text, "-"))
+}
+
+// MergeShort merges adjacent subtitles specified by opts into one, and returns the number of subtitles
+// merged into their previous one. Only subtitles having the same position and color are merged.
+// Subtitles should be sorted (as done by the readers).
+func (sp *SubsPack) MergeShort(opts *MergeShortOptions) (merged int) {
+	subs := sp.Subs[:0]
+	for _, s := range sp.Subs {
+		if n := len(subs); n > 0 {
+			prev := subs[n-1]
+			short := opts.ShortDuration <= 0 ||
+				prev.DisplayDuration() < opts.ShortDuration || s.DisplayDuration() < opts.ShortDuration
+			if short && s.TimeIn-prev.TimeOut < opts.MaxGap && s.Pos == prev.Pos && s.Color == prev.Color {
+				if lines, ok := opts.mergedLines(prev, s); ok {
+					prev.Lines = lines
+					if s.TimeOut > prev.TimeOut {
+						prev.TimeOut = s.TimeOut
+					}
+					merged++
+					continue
+				}
+			}
+		}
+		subs = append(subs, s)
+	}
+	sp.Subs = subs
+	return
+}
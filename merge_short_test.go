@@ -0,0 +1,70 @@
+package srtgears
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeShort(t *testing.T) {
+	// sub returns a subtitle displayed from in to out (seconds) with the given lines.
+	sub := func(in, out float64, lines ...string) *Subtitle {
+		s := timedSub(in, out, "")
+		s.Lines = lines
+		return s
+	}
+	opts := MergeShortOptions{MaxGap: 200 * time.Millisecond, ShortDuration: time.Second, MaxChars: 20, MaxLines: 2}
+	dialogueOpts := opts
+	dialogueOpts.MaxChars, dialogueOpts.Dialogue = 37, true
+
+	cases := []struct {
+		name      string
+		subs      []*Subtitle
+		opts      MergeShortOptions
+		exp       []string
+		expMerged int
+	}{
+		{"merged", []*Subtitle{sub(1, 1.5, "Hi."), sub(1.6, 2.5, "How are you?"), sub(2.6, 6, "Fine.")}, opts,
+			[]string{"Hi./How are you? 1s-2.5s", "Fine. 2.6s-6s"}, 1},
+		{"gap too long", []*Subtitle{sub(1, 1.5, "Hi."), sub(1.8, 2.5, "How are you?")}, opts,
+			[]string{"Hi. 1s-1.5s", "How are you? 1.8s-2.5s"}, 0},
+		{"not short", []*Subtitle{sub(1, 2.5, "Hi."), sub(2.6, 4, "How are you?")}, opts,
+			[]string{"Hi. 1s-2.5s", "How are you? 2.6s-4s"}, 0},
+		{"different pos", []*Subtitle{sub(1, 1.5, "Hi."), {TimeIn: 1600 * time.Millisecond, TimeOut: 2500 * time.Millisecond, Lines: []string{"Hello."}, Pos: Top}}, opts,
+			[]string{"Hi. 1s-1.5s", "Hello. 1.6s-2.5s"}, 0},
+		{"reflowed", []*Subtitle{sub(1, 1.5, "Where are you going", "at this hour?"), sub(1.6, 2.5, "Out.")}, opts,
+			[]string{"Where are you going/at this hour? Out. 1s-2.5s"}, 1},
+		{"too long", []*Subtitle{sub(1, 1.5, "Where are you going", "at this hour?"), sub(1.6, 2.5, "Out to the garden.")}, opts,
+			[]string{"Where are you going/at this hour? 1s-1.5s", "Out to the garden. 1.6s-2.5s"}, 0},
+		{"dialogue", []*Subtitle{sub(1, 1.5, "Hi."), sub(1.6, 2.5, "-Where are", "<i>you</i> <i>going?</i>")}, dialogueOpts,
+			[]string{"- Hi./- Where are <i>you going?</i> 1s-2.5s"}, 1},
+		{"no third speaker", []*Subtitle{sub(1, 1.5, "- Hi.", "- Hello."), sub(1.6, 2.5, "Bye.")}, dialogueOpts,
+			[]string{"- Hi./- Hello. 1s-1.5s", "Bye. 1.6s-2.5s"}, 0},
+	}
+	for _, c := range cases {
+		sp := &SubsPack{Subs: c.subs}
+		if merged := sp.MergeShort(&c.opts); merged != c.expMerged {
+			t.Errorf("[%s] Expected merged: %d, got: %d", c.name, c.expMerged, merged)
+		}
+		if got := timings(sp); !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("[%s] Expected: %q, got: %q", c.name, c.exp, got)
+		}
+	}
+}
+
+func TestDialogueLine(t *testing.T) {
+	cases := []struct {
+		lines []string
+		exp   string
+	}{
+		{[]string{"Hi."}, "- Hi."},
+		{[]string{"-Where are", "you going?"}, "- Where are you going?"},
+		{[]string{" - Out. "}, "- Out."},
+		{[]string{"<i>Where are</i>", "<i>you going?</i>"}, "- <i>Where are you going?</i>"},
+	}
+	for _, c := range cases {
+		if got := dialogueLine(c.lines); got != c.exp {
+			t.Errorf("[%q] Expected: %q, got: %q", c.lines, c.exp, got)
+		}
+	}
+}
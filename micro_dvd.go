@@ -0,0 +1,307 @@
+/*
+
+This file implements reading and writing the MicroDVD file format (*.sub).
+It can parse *.sub files and create model from them.
+And it can also generate MicroDVD content from a model.
+
+Format specifications:
+https://en.wikipedia.org/wiki/MicroDVD
+
+MicroDVD is frame based, so a frame rate is needed to convert frames to timestamps and back.
+If the first subtitle is "{1}{1}23.976", it specifies the frame rate of the file.
+
+The parser is permissive, it tries to parse the input even if it does not conform to the specification.
+
+Lines are separated by '|'. The {y:i}, {y:b}, {y:u} (per line) and {Y:i}, {Y:b}, {Y:u} (all lines)
+control codes are mapped to <i>, <b>, <u> formatting, {C:$BBGGRR} (all lines) to the subtitle color
+and {c:$BBGGRR} (per line) to <font color>.
+
+An example MicroDVD file:
+
+	{1}{1}23.976
+	{3292}{3363}Senator, we're making|our final approach into Coruscant.
+	{3365}{3413}{y:i}Very good, Lieutenant.
+
+*/
+
+package srtgears
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadMicroDVDFile reads and parses a MicroDVD file (*.sub) and builds the model from it.
+// fps is the frame rate to use if the file does not specify it.
+func ReadMicroDVDFile(name string, fps float64) (sp *SubsPack, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Reading from file: %s", name)
+	return ReadMicroDVDFrom(f, fps)
+}
+
+// Regexp pattern to extract frames and text from lines, e.g. "{3292}{3363}Senator".
+// The end frame may be empty. Number of digits of frames is limited so they can't overflow.
+var microDVDLinePattern = regexp.MustCompile(`^\s*{(\d{1,9})}{(\d{0,9})}(.*)$`)
+
+// Regexp pattern of control codes at the beginning of text, e.g. "{y:i}" or "{C:$0000FF}".
+var microDVDControlPattern = regexp.MustCompile(`^{([a-zA-Z]):([^}]*)}`)
+
+// ReadMicroDVDFrom reads and parses a MicroDVD from an io.Reader (*.sub) and builds the model from it.
+// fps is the frame rate to use if the input does not specify it.
+func ReadMicroDVDFrom(r io.Reader, fps float64) (sp *SubsPack, err error) {
+	sp = &SubsPack{}
+	scanner := bufio.NewScanner(r)
+
+	type frameSub struct {
+		in, out int64
+		s       *Subtitle
+	}
+	var subs []frameSub
+
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if lineNum == 0 {
+			// If BOM is present, strip it off. It's "\uFEFF", which is "\xef\xbb\xbf" in UTF-8
+			if strings.HasPrefix(line, "\xef\xbb\xbf") {
+				line = line[3:]
+			}
+		}
+		lineNum++
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := microDVDLinePattern.FindStringSubmatch(line)
+		if len(parts) == 0 {
+			debugf("Invalid line %d: %s", lineNum, line)
+			continue
+		}
+		// Only a limited number of digits are matched, so errors can be ignored
+		in, _ := strconv.ParseInt(parts[1], 10, 64)
+		out, _ := strconv.ParseInt(parts[2], 10, 64) // May be empty, it's 0 then
+
+		if len(subs) == 0 && in == 1 && out == 1 {
+			// Frame rate header?
+			if v, err := ParseFrameRate(parts[3]); err == nil {
+				fps = v
+				continue
+			}
+		}
+
+		s := &Subtitle{}
+		parseMicroDVDText(s, parts[3])
+		subs = append(subs, frameSub{in, out, s})
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	if fps <= 0 {
+		return nil, fmt.Errorf("Frame rate is not specified by the input nor by the caller")
+	}
+	sp.FrameRate = fps
+
+	for i, fs := range subs {
+		if fs.out == 0 {
+			// Missing end frame: display until the next subtitle
+			if i+1 < len(subs) {
+				fs.out = subs[i+1].in
+			} else {
+				fs.out = fs.in + int64(math.Round(fps*3)) // Display last one for 3 seconds
+			}
+		}
+		fs.s.TimeIn, fs.s.TimeOut = framesToDuration(fs.in, fps), framesToDuration(fs.out, fps)
+		if fs.s.TimeOut <= fs.s.TimeIn {
+			debugf("Frame1 >= Frame2, text won't be visible: {%d}{%d}", fs.in, fs.out)
+		}
+		sp.Subs = append(sp.Subs, fs.s)
+	}
+
+	debugf("Loaded %d subtitles.", len(sp.Subs))
+
+	sp.Sort()
+
+	return
+}
+
+// framesToDuration converts a frame number to a timestamp.
+func framesToDuration(frames int64, fps float64) time.Duration {
+	return time.Duration(math.Round(float64(frames) / fps * float64(time.Second)))
+}
+
+// durationToFrames converts a timestamp to a frame number.
+func durationToFrames(t time.Duration, fps float64) int64 {
+	return int64(math.Round(t.Seconds() * fps))
+}
+
+// parseMicroDVDText parses the text part of a MicroDVD line, and sets the lines and color of the subtitle.
+func parseMicroDVDText(s *Subtitle, text string) {
+	var allStyles []string // Styles applied to all lines
+
+	for i, line := range strings.Split(text, "|") {
+		var styles []string // Styles applied to this line
+		color := ""         // Color of this line
+
+		for {
+			parts := microDVDControlPattern.FindStringSubmatch(line)
+			if len(parts) == 0 {
+				break
+			}
+			line = line[len(parts[0]):]
+			switch parts[1] {
+			case "y", "Y":
+				for _, st := range strings.Split(strings.ToLower(parts[2]), ",") {
+					switch st = strings.TrimSpace(st); st {
+					case "i", "b", "u":
+						if parts[1] == "Y" {
+							allStyles = append(allStyles, st)
+						} else {
+							styles = append(styles, st)
+						}
+					}
+				}
+			case "c", "C":
+				c, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(parts[2]), "$"), 16, 64)
+				if err != nil {
+					break
+				}
+				if parts[1] == "C" {
+					s.Color = colorFromBGR(int(c))
+				} else {
+					color = colorFromBGR(int(c))
+				}
+			default:
+				// Other control codes (e.g. font, size, position) are not supported, dropped.
+			}
+			if i > 0 && parts[1] == strings.ToUpper(parts[1]) {
+				debugf("Control code for all lines not in first line: %s", parts[0])
+			}
+		}
+
+		styles = append(styles, allStyles...)
+		for _, st := range styles {
+			line = "<" + st + ">" + line + "</" + st + ">"
+		}
+		if color != "" {
+			line = `<font color="` + color + `">` + line + "</font>"
+		}
+		s.Lines = append(s.Lines, line)
+	}
+}
+
+// WriteMicroDVDFile generates MicroDVD format (*.sub) and writes it to a file.
+// fps is the frame rate to use, if not positive, sp.FrameRate is used.
+func WriteMicroDVDFile(name string, sp *SubsPack, fps float64) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Writing %d subtitles to file: %s", len(sp.Subs), name)
+	return WriteMicroDVDTo(f, sp, fps)
+}
+
+// microDVDText converts the lines of a subtitle to MicroDVD text.
+// HTML formatting is converted to control codes applied to the lines they appear in, controls are removed.
+func microDVDText(s *Subtitle) string {
+	var b strings.Builder
+
+	if c, ok := colorToBGR(s.Color); ok {
+		fmt.Fprintf(&b, "{C:$%06X}", c)
+	}
+
+	open := map[string]bool{} // Formatting still open from previous lines
+	var fontColor string      // Color of a <font> still open from previous lines
+
+	for i, line := range s.Lines {
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		line = anyControlPattern.ReplaceAllString(line, "")
+
+		used := map[string]bool{}
+		for k, v := range open {
+			used[k] = v
+		}
+		color := fontColor
+		for _, tag := range htmlPattern.FindAllString(line, -1) {
+			parts := formatTagPattern.FindStringSubmatch(tag)
+			if len(parts) == 0 {
+				continue
+			}
+			name, closing := strings.ToLower(parts[2]), parts[1] == "/"
+			if name == "font" {
+				if closing {
+					fontColor = ""
+				} else if m := fontColorPattern.FindStringSubmatch(parts[3]); len(m) > 0 {
+					fontColor, color = m[1], m[1]
+				}
+				continue
+			}
+			open[name] = !closing
+			if !closing {
+				used[name] = true
+			}
+		}
+
+		var styles []string
+		for _, st := range []string{"i", "b", "u"} {
+			if used[st] {
+				styles = append(styles, st)
+			}
+		}
+		if len(styles) > 0 {
+			fmt.Fprintf(&b, "{y:%s}", strings.Join(styles, ","))
+		}
+		if c, ok := colorToBGR(color); ok {
+			fmt.Fprintf(&b, "{c:$%06X}", c)
+		}
+
+		b.WriteString(htmlPattern.ReplaceAllString(line, ""))
+	}
+
+	return b.String()
+}
+
+// WriteMicroDVDTo generates MicroDVD format (*.sub) and writes it to an io.Writer.
+// fps is the frame rate to use, if not positive, sp.FrameRate is used.
+func WriteMicroDVDTo(w io.Writer, sp *SubsPack, fps float64) error {
+	if fps <= 0 {
+		fps = sp.FrameRate
+	}
+	if fps <= 0 {
+		return fmt.Errorf("Frame rate must be specified for MicroDVD output")
+	}
+
+	wr := &writer{w: w}
+
+	// BOM
+	wr.pr("\xef\xbb\xbf")
+
+	// Frame rate header, NTSC rates (e.g. 24000/1001) are written rounded (e.g. 23.976), ParseFrameRate() restores them
+	wr.prn("{1}{1}", strconv.FormatFloat(math.Round(fps*1000)/1000, 'f', -1, 64))
+
+	for _, s := range sp.Subs {
+		if wr.err != nil {
+			break
+		}
+		wr.prf("{%d}{%d}", durationToFrames(s.TimeIn, fps), durationToFrames(s.TimeOut, fps))
+		wr.prn(microDVDText(s))
+	}
+
+	return wr.err
+}
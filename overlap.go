@@ -0,0 +1,263 @@
+/*
+
+This file implements detecting and resolving overlapping subtitles.
+
+Overlapping subtitles of the same track (e.g. after concatenating) are rendered on top of each other
+by some players. Subtitles at different positions (e.g. the tracks of merged dual subtitles) don't overlap,
+subtitles with no position specified are at the bottom. Overlaps can be resolved by trimming the previous subtitle,
+shifting the next one, splitting the overlapping time range into segments having the combined text,
+or by stacking the subtitles at different vertical positions.
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OverlapStrategy tells how overlapping subtitles are resolved.
+type OverlapStrategy int
+
+// Overlap resolution strategies.
+const (
+	// OverlapTrim trims the previous subtitle to end when the next one starts. Subtitles starting at the same time
+	// as the previous one are combined into it.
+	OverlapTrim OverlapStrategy = iota
+	// OverlapShift shifts the next subtitle (keeping its display duration) to start when the previous one ends.
+	OverlapShift
+	// OverlapCombine splits overlapping subtitles into segments at their timestamps, segments display
+	// the combined text of the subtitles visible during them.
+	OverlapCombine
+	// OverlapStack moves overlapping subtitles to different vertical positions (bottom, top, middle).
+	OverlapStack
+)
+
+// Names of the overlap strategies.
+var overlapStrategyNames = map[OverlapStrategy]string{
+	OverlapTrim:    "trim",
+	OverlapShift:   "shift",
+	OverlapCombine: "combine",
+	OverlapStack:   "stack",
+}
+
+// String returns the name of the strategy.
+func (st OverlapStrategy) String() string {
+	if name, ok := overlapStrategyNames[st]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverlapStrategy(%d)", int(st))
+}
+
+// Overlap describes 2 overlapping subtitles.
+type Overlap struct {
+	Index1, Index2 int           // Indices of the overlapping subtitles (in time order)
+	TimeIn         time.Duration // Timestamp when the overlap starts
+	Duration       time.Duration // Duration of the overlap
+}
+
+// String returns a human readable description of the overlap.
+func (o Overlap) String() string {
+	return fmt.Sprintf("#%d and #%d overlap for %v", o.Index1+1, o.Index2+1, o.Duration)
+}
+
+// Overlaps returns the overlapping subtitle pairs of the same track (position).
+// Subtitles should be sorted (as done by the readers).
+func (sp *SubsPack) Overlaps() (overlaps []Overlap) {
+	for i, s := range sp.Subs {
+		for j := i + 1; j < len(sp.Subs) && sp.Subs[j].TimeIn < s.TimeOut; j++ {
+			s2 := sp.Subs[j]
+			end := s.TimeOut
+			if s2.TimeOut < end {
+				end = s2.TimeOut
+			}
+			if end > s2.TimeIn && trackPos(s2.Pos) == trackPos(s.Pos) {
+				overlaps = append(overlaps, Overlap{Index1: i, Index2: j, TimeIn: s2.TimeIn, Duration: end - s2.TimeIn})
+			}
+		}
+	}
+	return
+}
+
+// ResolveOverlaps resolves overlapping subtitles using the given strategy,
+// and returns the overlaps found (indices refer to the subtitles before resolving).
+// Subtitles are sorted first. Overlaps are resolved inside tracks, other tracks are left intact.
+func (sp *SubsPack) ResolveOverlaps(strategy OverlapStrategy) ([]Overlap, error) {
+	sp.Sort()
+	overlaps := sp.Overlaps()
+	if len(overlaps) == 0 {
+		return nil, nil
+	}
+
+	var resolve func(track *SubsPack)
+	switch strategy {
+	case OverlapTrim:
+		resolve = (*SubsPack).trimOverlaps
+	case OverlapShift:
+		resolve = (*SubsPack).shiftOverlaps
+	case OverlapCombine:
+		resolve = (*SubsPack).combineOverlaps
+	case OverlapStack:
+		sp.stackOverlaps()
+		return overlaps, nil
+	default:
+		return nil, fmt.Errorf("Invalid overlap strategy: %v", strategy)
+	}
+
+	var subs []*Subtitle
+	for _, track := range sp.tracks() {
+		resolve(track)
+		subs = append(subs, track.Subs...)
+	}
+	sort.Stable(SortSubtitles(subs))
+	sp.Subs = subs
+	return overlaps, nil
+}
+
+// tracks splits the subtitles into tracks by position (see trackPos()), keeping their order.
+func (sp *SubsPack) tracks() (tracks []*SubsPack) {
+	byPos := map[Pos]*SubsPack{}
+	for _, s := range sp.Subs {
+		track := byPos[trackPos(s.Pos)]
+		if track == nil {
+			track = &SubsPack{}
+			byPos[trackPos(s.Pos)] = track
+			tracks = append(tracks, track)
+		}
+		track.Subs = append(track.Subs, s)
+	}
+	return
+}
+
+// trimOverlaps trims subtitles to end when the next one starts.
+func (sp *SubsPack) trimOverlaps() {
+	subs := sp.Subs[:0]
+	for _, s := range sp.Subs {
+		if n := len(subs); n > 0 {
+			prev := subs[n-1]
+			if s.TimeIn <= prev.TimeIn {
+				// Trimming would leave nothing of prev, combine them
+				prev.Lines = append(prev.Lines, s.Lines...)
+				if s.TimeOut > prev.TimeOut {
+					prev.TimeOut = s.TimeOut
+				}
+				continue
+			}
+			if prev.TimeOut > s.TimeIn {
+				prev.TimeOut = s.TimeIn
+			}
+		}
+		subs = append(subs, s)
+	}
+	sp.Subs = subs
+}
+
+// shiftOverlaps shifts subtitles to start when the previous one ends.
+func (sp *SubsPack) shiftOverlaps() {
+	for i := 1; i < len(sp.Subs); i++ {
+		if prev, s := sp.Subs[i-1], sp.Subs[i]; s.TimeIn < prev.TimeOut {
+			s.Shift(prev.TimeOut - s.TimeIn)
+		}
+	}
+}
+
+// combineOverlaps splits groups of overlapping subtitles into segments having the combined text.
+func (sp *SubsPack) combineOverlaps() {
+	var subs []*Subtitle
+	for i := 0; i < len(sp.Subs); {
+		// Group of overlapping subtitles: sp.Subs[i:j]
+		j, end := i+1, sp.Subs[i].TimeOut
+		for ; j < len(sp.Subs) && sp.Subs[j].TimeIn < end; j++ {
+			if sp.Subs[j].TimeOut > end {
+				end = sp.Subs[j].TimeOut
+			}
+		}
+		group := sp.Subs[i:j]
+		i = j
+		if len(group) == 1 {
+			subs = append(subs, group[0])
+			continue
+		}
+
+		var times []time.Duration
+		for _, s := range group {
+			times = append(times, s.TimeIn, s.TimeOut)
+		}
+		sort.Slice(times, func(a, b int) bool { return times[a] < times[b] })
+
+		for k := 1; k < len(times); k++ {
+			from, to := times[k-1], times[k]
+			if from == to {
+				continue
+			}
+			var seg *Subtitle
+			for _, s := range group {
+				if s.TimeIn > from || s.TimeOut < to {
+					continue // Not visible during the whole segment
+				}
+				if seg == nil {
+					seg = &Subtitle{TimeIn: from, TimeOut: to, Pos: s.Pos, Color: s.Color}
+				}
+				seg.Lines = append(seg.Lines, s.Lines...)
+			}
+			if seg == nil {
+				continue // Gap inside the group
+			}
+			if n := len(subs); n > 0 && subs[n-1].TimeOut == from && sameLines(subs[n-1].Lines, seg.Lines) {
+				subs[n-1].TimeOut = to // Same text continues
+				continue
+			}
+			subs = append(subs, seg)
+		}
+	}
+	sp.Subs = subs
+}
+
+// sameLines tells if the 2 line slices are equal.
+func sameLines(a, b []string) bool {
+	return strings.Join(a, "\n") == strings.Join(b, "\n")
+}
+
+// stackOverlaps moves overlapping subtitles to different vertical positions: if the position
+// of a subtitle is used by a visible previous one, it is moved to the first free row of bottom, top and middle
+// (keeping its horizontal alignment).
+func (sp *SubsPack) stackOverlaps() {
+	// posRowCol returns the row (0: bottom, 1: middle, 2: top) and column of a position.
+	posRowCol := func(p Pos) (row, col int) {
+		if p == PosNotSpecified {
+			return 0, 1
+		}
+		return int(p-1) / 3, int(p-1) % 3
+	}
+
+	var visible []*Subtitle // Previous subtitles still visible
+	for _, s := range sp.Subs {
+		var used [3]bool
+		stillVisible := visible[:0]
+		for _, prev := range visible {
+			if prev.TimeOut > s.TimeIn {
+				row, _ := posRowCol(prev.Pos)
+				used[row] = true
+				stillVisible = append(stillVisible, prev)
+			}
+		}
+		visible = append(stillVisible, s)
+
+		row, col := posRowCol(s.Pos)
+		if !used[row] {
+			continue
+		}
+		for _, r := range []int{0, 2, 1} {
+			if !used[r] {
+				s.Pos = posGrid[r][col]
+				if s.Pos == Bottom {
+					s.Pos = PosNotSpecified // Bottom is the default position
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package srtgears
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timedSub returns a subtitle displayed from in to out (seconds) with the given text.
+func timedSub(in, out float64, text string) *Subtitle {
+	return &Subtitle{
+		TimeIn:  time.Duration(in * float64(time.Second)),
+		TimeOut: time.Duration(out * float64(time.Second)),
+		Lines:   []string{text},
+	}
+}
+
+// timings returns the text and timing of the subtitles, in the form "text from-to".
+func timings(sp *SubsPack) (res []string) {
+	for _, s := range sp.Subs {
+		res = append(res, strings.Join(s.Lines, "/")+" "+s.TimeIn.String()+"-"+s.TimeOut.String())
+	}
+	return
+}
+
+func TestResolveOverlaps(t *testing.T) {
+	cases := []struct {
+		name     string
+		strategy OverlapStrategy
+		exp      []string
+	}{
+		{"trim", OverlapTrim, []string{"a 1s-3s", "top 2s-5s", "b 3s-6s", "c 7s-8s"}},
+		{"shift", OverlapShift, []string{"a 1s-4s", "top 2s-5s", "b 4s-7s", "c 7s-8s"}},
+		{"combine", OverlapCombine, []string{"a 1s-3s", "top 2s-5s", "a/b 3s-4s", "b 4s-6s", "c 7s-8s"}},
+	}
+	for _, c := range cases {
+		sp := &SubsPack{Subs: []*Subtitle{timedSub(1, 4, "a"), timedSub(3, 6, "b"), timedSub(7, 8, "c")}}
+		sp.Merge(&SubsPack{Subs: []*Subtitle{timedSub(2, 5, "top")}})
+
+		overlaps, err := sp.ResolveOverlaps(c.strategy)
+		if err != nil {
+			t.Errorf("[%s] Unexpected error: %v", c.name, err)
+			continue
+		}
+		// Only "a" (#1) and "b" (#3) overlap, the top track is another track
+		if expOverlaps := []Overlap{{0, 2, 3 * time.Second, time.Second}}; !reflect.DeepEqual(overlaps, expOverlaps) {
+			t.Errorf("[%s] Expected overlaps: %v, got: %v", c.name, expOverlaps, overlaps)
+		}
+		if got := timings(sp); !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, got)
+		}
+	}
+}
+
+func TestOverlapsTracks(t *testing.T) {
+	sp := &SubsPack{Subs: []*Subtitle{timedSub(1, 4, "a"), timedSub(2, 3, "top")}}
+	sp.Subs[1].Pos = Top
+	if overlaps := sp.Overlaps(); len(overlaps) != 0 {
+		t.Errorf("Expected no overlaps, got: %v", overlaps)
+	}
+
+	// Not specified is the same as bottom
+	sp.Subs[1].Pos = Bottom
+	if overlaps := sp.Overlaps(); len(overlaps) != 1 {
+		t.Errorf("Expected 1 overlap, got: %v", overlaps)
+	}
+}
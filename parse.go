@@ -0,0 +1,75 @@
+/*
+
+This file defines the types used to control parsing and to report problems found in the input.
+
+By default parsers are permissive: they try to parse the input even if it does not conform
+to the specification, and only log the problems (if Debug is set). ParseOptions can be used
+to get the problems as ParseWarnings instead, or to reject non-conforming input (strict mode).
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseOptions controls parsing.
+type ParseOptions struct {
+	// Strict tells to reject input having problems: a *ParseError is returned listing all problems.
+	// If false, problems are returned as ParseWarnings along with the parsed subtitles.
+	Strict bool
+}
+
+// ParseWarningCategory is the category of a problem found when parsing.
+type ParseWarningCategory int
+
+// Categories of problems found when parsing.
+const (
+	InvalidSeqNum    ParseWarningCategory = iota // Sequence number line is not a number
+	InvalidTimestamp                             // Timestamp line cannot be parsed
+	InvalidTimeOrder                             // TimeOut <= TimeIn, text won't be visible
+)
+
+// Human readable names of the categories.
+var parseWarningCategoryNames = map[ParseWarningCategory]string{
+	InvalidSeqNum:    "invalid sequence number",
+	InvalidTimestamp: "invalid timestamp",
+	InvalidTimeOrder: "time1 >= time2, text won't be visible",
+}
+
+// String returns the human readable name of the category.
+func (c ParseWarningCategory) String() string {
+	if name, ok := parseWarningCategoryNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ParseWarningCategory(%d)", int(c))
+}
+
+// ParseWarning describes a problem found when parsing.
+type ParseWarning struct {
+	Line     int                  // Line number (1-based)
+	Col      int                  // Column (1-based, in characters)
+	Category ParseWarningCategory // Category of the problem
+	Text     string               // Content of the line
+}
+
+// String returns a human readable description of the warning.
+func (pw ParseWarning) String() string {
+	return fmt.Sprintf("line %d, col %d: %s: %s", pw.Line, pw.Col, pw.Category, pw.Text)
+}
+
+// ParseError is returned in strict mode if the input has problems.
+type ParseError struct {
+	Warnings []ParseWarning // Problems found in the input
+}
+
+// Error implements the error interface.
+func (pe *ParseError) Error() string {
+	msgs := make([]string, len(pe.Warnings))
+	for i, pw := range pe.Warnings {
+		msgs[i] = pw.String()
+	}
+	return fmt.Sprintf("Invalid input, %d problem(s) found: %s", len(pe.Warnings), strings.Join(msgs, "; "))
+}
@@ -0,0 +1,280 @@
+/*
+
+This file implements re-wrapping (reflowing) the text of subtitles to a max line length.
+
+Text is re-broken at word boundaries into the min number of lines that fit the max line length.
+Among the possible breaks the most balanced one is chosen, preferring the shape given by ReflowShape
+and breaking after punctuation. The pyramid shape prefers each line to be longer than the one above it,
+the bottom-heavy shape only prefers the last line to be the longest (the 2 are the same for 2 lines).
+
+Formatting tags (e.g. <i>) and controls (e.g. {\an8}) are not counted in the line length. Formatting tags
+open at a line break are closed at the end of the line and reopened at the beginning of the next line.
+Dialogue lines (all lines starting with a dash) are reflowed separately.
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ReflowShape is the preferred shape of reflowed lines.
+type ReflowShape int
+
+// Reflow shapes.
+const (
+	// ReflowPyramid prefers each line to be longer than the one above it. This is the default.
+	ReflowPyramid ReflowShape = iota
+	// ReflowBottomHeavy prefers the last line to be the longest, upper lines are just balanced.
+	ReflowBottomHeavy
+)
+
+// Names of the reflow shapes.
+var reflowShapeNames = map[ReflowShape]string{
+	ReflowPyramid:     "pyramid",
+	ReflowBottomHeavy: "bottom",
+}
+
+// String returns the name of the shape.
+func (sh ReflowShape) String() string {
+	if name, ok := reflowShapeNames[sh]; ok {
+		return name
+	}
+	return fmt.Sprintf("ReflowShape(%d)", int(sh))
+}
+
+// reflowWord is a word of the text to reflow.
+type reflowWord struct {
+	text  string // Text of the word including formatting and controls
+	width int    // Visible width of the word (number of runes without formatting and controls)
+}
+
+// visibleWidth returns the number of visible runes of s (formatting and controls excluded).
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(plainText(s))
+}
+
+// splitWords splits text into words at white space outside of formatting tags and controls.
+func splitWords(text string) (words []reflowWord) {
+	var closer rune // Closing rune of the tag or control we're in, 0 if not in any
+	start := -1     // Start of the current word, -1 if not in a word
+	for i, r := range text {
+		switch {
+		case closer != 0:
+			if r == closer {
+				closer = 0
+			}
+		case r == '<':
+			closer = '>'
+		case r == '{':
+			closer = '}'
+		case unicode.IsSpace(r):
+			if start >= 0 {
+				words = append(words, reflowWord{text[start:i], visibleWidth(text[start:i])})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, reflowWord{text[start:], visibleWidth(text[start:])})
+	}
+	return
+}
+
+// breakWords breaks words into the min number of lines not longer than maxChars (if possible),
+// choosing the most balanced breaks of the given shape.
+func breakWords(words []reflowWord, maxChars int, shape ReflowShape) (lines [][]reflowWord) {
+	// widths[i] is the width of words[:i] joined with spaces plus 1
+	widths := make([]int, len(words)+1)
+	for i, w := range words {
+		widths[i+1] = widths[i] + w.width + 1
+	}
+	// width returns the width of the line of words[i:j]
+	width := func(i, j int) int {
+		return widths[j] - widths[i] - 1
+	}
+	// fits tells if the line of words[i:j] fits (a single word always fits)
+	fits := func(i, j int) bool {
+		return j-i == 1 || width(i, j) <= maxChars
+	}
+
+	// Min number of lines: greedy
+	n := 1
+	for i, j := 0, 1; j <= len(words); j++ {
+		if !fits(i, j) {
+			n, i = n+1, j-1
+		}
+	}
+
+	// Lines are never wider than limit: maxChars, or the widest word if it is wider
+	limit := maxChars
+	for _, w := range words {
+		if w.width > limit {
+			limit = w.width
+		}
+	}
+	// upperWidth returns the width upper lines are compared to after a line of width w following upper lines of upper:
+	// the previous line for pyramid, the widest upper line for bottom-heavy.
+	upperWidth := func(upper, w int) int {
+		if shape == ReflowBottomHeavy && upper > w {
+			return upper
+		}
+		return w
+	}
+	// lineCost returns the cost of the line of words[start:end] following upper lines of upper width
+	// (see upperWidth, -1 if first line).
+	lineCost := func(start, end, upper int) float64 {
+		w := width(start, end)
+		c := float64(w * w)
+		if upper > w && (shape != ReflowBottomHeavy || end == len(words)) {
+			c += 4 * float64(upper-w) // Prefer the shape
+		}
+		return c
+	}
+
+	// Search the best breaks into n lines: min cost of breaking words[start:] into left lines
+	// following upper lines of upper width, memoized.
+	type state struct{ start, left, upper int }
+	type result struct {
+		cost float64
+		end  int // End of the first line
+	}
+	memo := map[state]result{}
+	var search func(start, left, upper int) result
+	search = func(start, left, upper int) result {
+		st := state{start, left, upper}
+		if r, ok := memo[st]; ok {
+			return r
+		}
+		r := result{cost: math.Inf(1)}
+		// Cut if the remaining words can't fit into left lines
+		if width(start, len(words)) <= left*limit+left-1 {
+			if left == 1 {
+				if fits(start, len(words)) {
+					r = result{lineCost(start, len(words), upper), len(words)}
+				}
+			} else {
+				for end := start + 1; end <= len(words)-left+1 && fits(start, end); end++ {
+					c := lineCost(start, end, upper)
+					if visible := []rune(plainText(words[end-1].text)); len(visible) > 0 &&
+						strings.ContainsRune(",.;:!?", visible[len(visible)-1]) {
+						c -= float64(maxChars) // Prefer breaking after punctuation
+					}
+					if c += search(end, left-1, upperWidth(upper, width(start, end))).cost; c < r.cost {
+						r = result{c, end}
+					}
+				}
+			}
+		}
+		memo[st] = r
+		return r
+	}
+
+	if math.IsInf(search(0, n, -1).cost, 1) { // Should not happen, but be well-behaved
+		return [][]reflowWord{words}
+	}
+	for start, left, upper := 0, n, -1; left > 0; left-- {
+		end := search(start, left, upper).end
+		lines = append(lines, words[start:end])
+		start, upper = end, upperWidth(upper, width(start, end))
+	}
+	return
+}
+
+// openTag is a formatting tag open in the text.
+type openTag struct {
+	tag  string // The opening tag, e.g. "<i>"
+	name string // Lowercased name of the tag, e.g. "i"
+}
+
+// balanceTags closes formatting tags open at the end of lines, and reopens them at the beginning of the next line.
+func balanceTags(lines []string) []string {
+	var open []openTag
+	for i, line := range lines {
+		prefix := ""
+		for _, ot := range open {
+			prefix += ot.tag
+		}
+		for _, tag := range htmlPattern.FindAllString(line, -1) {
+			parts := formatTagPattern.FindStringSubmatch(tag)
+			if len(parts) == 0 {
+				continue
+			}
+			name := strings.ToLower(parts[2])
+			if parts[1] != "/" {
+				open = append(open, openTag{tag, name})
+			} else if n := len(open); n > 0 && open[n-1].name == name {
+				open = open[:n-1]
+			}
+		}
+		suffix := ""
+		if i+1 < len(lines) {
+			for j := len(open) - 1; j >= 0; j-- {
+				suffix += "</" + open[j].name + ">"
+			}
+		}
+		lines[i] = prefix + line + suffix
+	}
+	return lines
+}
+
+// Replacer to join formatting closed at the end of a line and reopened at the beginning of the next one.
+var rejoinTagsReplacer = strings.NewReplacer("</i> <i>", " ", "</b> <b>", " ", "</u> <u>", " ")
+
+// Reflow re-breaks the text of the subtitle at word boundaries into balanced lines of the given shape
+// not longer than maxChars (see the file doc for details). maxChars must be positive. Returns true if the result
+// fits maxChars and maxLines (a single word longer than maxChars is not broken; maxLines <= 0 means no limit).
+func (s *Subtitle) Reflow(maxChars, maxLines int, shape ReflowShape) (fits bool) {
+	// Dialogue lines are reflowed separately
+	paragraphs := s.Lines
+	if !s.isDialogue() {
+		paragraphs = []string{rejoinTagsReplacer.Replace(strings.Join(s.Lines, " "))}
+	}
+
+	var lines []string
+	for _, p := range paragraphs {
+		words := splitWords(p)
+		if len(words) == 0 {
+			continue
+		}
+		for _, lineWords := range breakWords(words, maxChars, shape) {
+			texts := make([]string, len(lineWords))
+			for i, w := range lineWords {
+				texts[i] = w.text
+			}
+			lines = append(lines, strings.Join(texts, " "))
+		}
+	}
+	if len(lines) == 0 {
+		return true // No text
+	}
+	s.Lines = balanceTags(lines)
+
+	fits = maxLines <= 0 || len(s.Lines) <= maxLines
+	for _, line := range s.Lines {
+		if visibleWidth(line) > maxChars {
+			fits = false
+		}
+	}
+	return
+}
+
+// Reflow re-breaks the text of all subtitles into balanced lines of the given shape not longer than maxChars
+// (see Subtitle.Reflow()), and returns the number of subtitles that don't fit maxChars and maxLines.
+func (sp *SubsPack) Reflow(maxChars, maxLines int, shape ReflowShape) (unfit int) {
+	for _, s := range sp.Subs {
+		if !s.Reflow(maxChars, maxLines, shape) {
+			unfit++
+		}
+	}
+	return
+}
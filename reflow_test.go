@@ -0,0 +1,87 @@
+package srtgears
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReflow(t *testing.T) {
+	cases := []struct {
+		name     string
+		lines    []string
+		maxChars int
+		maxLines int
+		shape    ReflowShape
+		exp      []string
+		expFits  bool
+	}{
+		{"balanced", []string{"You should have seen the look on his face when she walked in."}, 37, 2, ReflowPyramid,
+			[]string{"You should have seen the look", "on his face when she walked in."}, true},
+		{"ragged", []string{"I told you", "already, it is not here and never was, so stop looking."}, 37, 2, ReflowPyramid,
+			[]string{"I told you already, it is not here", "and never was, so stop looking."}, true},
+		{"punctuation", []string{"We were there, all of us, the whole night long."}, 37, 2, ReflowPyramid,
+			[]string{"We were there, all of us,", "the whole night long."}, true},
+		{"pyramid", []string{"aaa b cc ddd ee fffff ggg"}, 9, 3, ReflowPyramid,
+			[]string{"aaa b", "cc ddd ee", "fffff ggg"}, true},
+		{"bottom-heavy", []string{"aaa b cc ddd ee fffff ggg"}, 9, 3, ReflowBottomHeavy,
+			[]string{"aaa b cc", "ddd ee", "fffff ggg"}, true},
+		{"tags balanced", []string{"<i>You should have seen the look on his face when she walked in.</i>"}, 37, 2, ReflowPyramid,
+			[]string{"<i>You should have seen the look</i>", "<i>on his face when she walked in.</i>"}, true},
+		{"nested tags", []string{`<font color="red">Árvíztűrő <b>tükörfúrógép</b> és még sok más szöveg</font>`}, 20, 3, ReflowPyramid,
+			[]string{`<font color="red">Árvíztűrő</font>`, `<font color="red"><b>tükörfúrógép</b> és</font>`, `<font color="red">még sok más szöveg</font>`}, true},
+		{"tags rejoined", []string{"<i>You should have seen</i>", "<i>the look on his face.</i>"}, 45, 2, ReflowPyramid,
+			[]string{"<i>You should have seen the look on his face.</i>"}, true},
+		{"controls not counted", []string{`{\an8}<b>You should have seen</b> the look on his face when she walked in.`}, 37, 2, ReflowPyramid,
+			[]string{`{\an8}<b>You should have seen</b> the look`, "on his face when she walked in."}, true},
+		{"dialogue", []string{"- Where are you going at this hour?", "- Out."}, 20, 3, ReflowPyramid,
+			[]string{"- Where are you", "going at this hour?", "- Out."}, true},
+		{"too many lines", []string{"You should have seen the look on his face when she walked in."}, 20, 2, ReflowPyramid,
+			[]string{"You should have seen", "the look on his face", "when she walked in."}, false},
+		{"long word", []string{"Supercalifragilisticexpialidocious!"}, 10, 2, ReflowPyramid,
+			[]string{"Supercalifragilisticexpialidocious!"}, false},
+	}
+	for _, c := range cases {
+		s := &Subtitle{Lines: c.lines}
+		if fits := s.Reflow(c.maxChars, c.maxLines, c.shape); fits != c.expFits {
+			t.Errorf("[%s] Expected fits: %v, got: %v", c.name, c.expFits, fits)
+		}
+		if !reflect.DeepEqual(s.Lines, c.exp) {
+			t.Errorf("[%s] Expected: %q, got: %q", c.name, c.exp, s.Lines)
+		}
+	}
+}
+
+func TestBreakWordsMinLines(t *testing.T) {
+	// Long text: the memoized search must find the min number of lines quickly
+	words := splitWords(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20))
+	minLines, width := 0, 0 // Greedy
+	for _, w := range words {
+		if minLines == 0 || width+1+w.width > 42 {
+			minLines, width = minLines+1, w.width
+		} else {
+			width += 1 + w.width
+		}
+	}
+	for _, shape := range []ReflowShape{ReflowPyramid, ReflowBottomHeavy} {
+		lines := breakWords(words, 42, shape)
+		if len(lines) != minLines {
+			t.Errorf("[%v] Expected lines: %d, got: %d", shape, minLines, len(lines))
+		}
+		count := 0
+		for _, line := range lines {
+			if width := len(line) - 1; width >= 0 {
+				for _, w := range line {
+					width += w.width
+				}
+				if width > 42 {
+					t.Errorf("[%v] Line too long: %d", shape, width)
+				}
+			}
+			count += len(line)
+		}
+		if count != len(words) {
+			t.Errorf("[%v] Expected words: %d, got: %d", shape, len(words), count)
+		}
+	}
+}
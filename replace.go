@@ -0,0 +1,166 @@
+/*
+
+This file implements find and replace rules applied to the text of subtitles (e.g. to fix OCR and style errors).
+
+Rules are applied in order, so a rule sees the result of the previous ones.
+Rules can be loaded from a rules file, one rule per line:
+
+	# Lines starting with '#' are comments, empty lines are ignored.
+	l'm => I'm
+	... => …
+	/ +([,!?])/ => $1
+	"  " => " "
+
+A rule is a literal or a regexp (between slashes) to find, and its replacement separated by "=>".
+Leading and trailing white space of both sides is trimmed, quote them (Go syntax) to keep it.
+Replacements of regexp rules may refer to submatches, e.g. $1 (see regexp.Regexp.Expand()).
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReplaceRule is a find and replace rule.
+type ReplaceRule struct {
+	Find    string         // Text to find; for regexp rules the source of Regexp
+	Regexp  *regexp.Regexp // Regexp to find, nil for literal rules
+	Replace string         // Replacement; for regexp rules it may refer to submatches, e.g. $1
+}
+
+// String returns the rule in the form used in rules files.
+func (r *ReplaceRule) String() string {
+	find := r.Find
+	if r.Regexp != nil {
+		find = "/" + find + "/"
+	}
+	return quoteRuleSide(find) + " => " + quoteRuleSide(r.Replace)
+}
+
+// quoteRuleSide quotes a side of a rule if it would not be parsed back as-is.
+func quoteRuleSide(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "#") || strings.Contains(s, "=>") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// unquoteRuleSide unquotes a side of a rule if it is quoted, else trims it.
+func unquoteRuleSide(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// ParseReplaceRules parses find and replace rules from a rules file (see the file doc for its format).
+func ParseReplaceRules(data []byte) (rules []*ReplaceRule, err error) {
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// A quoted find may contain "=>"
+		sepFrom := 0
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid replace rule in line %d: %s (%v)", i+1, line, err)
+			}
+			sepFrom = len(quoted)
+		}
+		idx := strings.Index(line[sepFrom:], "=>")
+		if idx < 0 {
+			return nil, fmt.Errorf("Invalid replace rule in line %d, missing '=>': %s", i+1, line)
+		}
+		idx += sepFrom
+
+		rule := &ReplaceRule{}
+		if rule.Find, err = unquoteRuleSide(line[:idx]); err == nil {
+			rule.Replace, err = unquoteRuleSide(line[idx+2:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid replace rule in line %d: %s (%v)", i+1, line, err)
+		}
+		if len(rule.Find) > 2 && strings.HasPrefix(rule.Find, "/") && strings.HasSuffix(rule.Find, "/") {
+			rule.Find = rule.Find[1 : len(rule.Find)-1]
+			if rule.Regexp, err = regexp.Compile(rule.Find); err != nil {
+				return nil, fmt.Errorf("Invalid regexp in replace rule in line %d: %s (%v)", i+1, line, err)
+			}
+		}
+		if rule.Find == "" {
+			return nil, fmt.Errorf("Invalid replace rule in line %d, nothing to find: %s", i+1, line)
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// apply applies the rule to text, and returns the result and the number of replacements.
+func (r *ReplaceRule) apply(text string) (string, int) {
+	if r.Regexp == nil {
+		if r.Find == "" {
+			return text, 0
+		}
+		n := strings.Count(text, r.Find)
+		if n == 0 {
+			return text, 0
+		}
+		return strings.Replace(text, r.Find, r.Replace, -1), n
+	}
+	n := len(r.Regexp.FindAllStringIndex(text, -1))
+	if n == 0 {
+		return text, 0
+	}
+	return r.Regexp.ReplaceAllString(text, r.Replace), n
+}
+
+// Regexp pattern of formatting tags and controls.
+var tagOrControlPattern = regexp.MustCompile(`<[^>]+>|{\\[^}]*}`)
+
+// applyOutsideTags applies the rule to text outside of formatting tags and controls,
+// and returns the result and the number of replacements.
+func (r *ReplaceRule) applyOutsideTags(text string) (string, int) {
+	var b strings.Builder
+	count, start := 0, 0
+	replaceSegment := func(segment string) {
+		s, n := r.apply(segment)
+		b.WriteString(s)
+		count += n
+	}
+	for _, loc := range tagOrControlPattern.FindAllStringIndex(text, -1) {
+		replaceSegment(text[start:loc[0]])
+		b.WriteString(text[loc[0]:loc[1]])
+		start = loc[1]
+	}
+	replaceSegment(text[start:])
+	return b.String(), count
+}
+
+// Replace applies the find and replace rules in order to the lines of the subtitles,
+// and returns the number of replacements per rule.
+// If outsideTags is true, formatting tags (e.g. <i>) and controls (e.g. {\an8}) are left intact.
+func (sp *SubsPack) Replace(rules []*ReplaceRule, outsideTags bool) (counts []int) {
+	counts = make([]int, len(rules))
+	for i, rule := range rules {
+		apply := rule.apply
+		if outsideTags {
+			apply = rule.applyOutsideTags
+		}
+		for _, s := range sp.Subs {
+			for j, line := range s.Lines {
+				var n int
+				s.Lines[j], n = apply(line)
+				counts[i] += n
+			}
+		}
+	}
+	return
+}
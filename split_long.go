@@ -0,0 +1,212 @@
+/*
+
+This file implements splitting over-long subtitles (e.g. from machine transcripts) into several consecutive subtitles.
+
+A subtitle is split if its text doesn't fit the max line length and max number of lines (see Subtitle.Reflow()),
+or if it is displayed longer than a max duration. The text is split recursively into 2 parts at the best break:
+at dialogue dashes, after sentence punctuation, after clause punctuation, near the middle of the text.
+If the subtitle is displayed too long, its longest parts are split further until there are enough parts.
+The display time of the original subtitle is distributed among the parts proportionally to their text length.
+
+*/
+
+package srtgears
+
+import (
+	"strings"
+	"time"
+)
+
+// breakScore returns the score of breaking words before index i: higher is better.
+func breakScore(words []reflowWord, i int) (score float64) {
+	plain := func(s string) []rune {
+		return []rune(strings.TrimSpace(plainText(s)))
+	}
+	if next := plain(words[i].text); len(next) > 0 && next[0] == '-' {
+		score = 4 // Dialogue dash
+	} else if prev := plain(words[i-1].text); len(prev) > 0 {
+		switch prev[len(prev)-1] {
+		case '.', '!', '?', '…':
+			score = 3
+		case ',', ';', ':', '–', '—':
+			score = 2
+		}
+	}
+
+	// Prefer balanced parts
+	left, total := 0, 0
+	for j, w := range words {
+		if j < i {
+			left += w.width
+		}
+		total += w.width
+	}
+	if total > 0 {
+		imbalance := float64(2*left-total) / float64(total)
+		if imbalance < 0 {
+			imbalance = -imbalance
+		}
+		score -= 4 * imbalance
+	}
+	return
+}
+
+// SplitLong splits the subtitle into several consecutive subtitles if its text doesn't fit
+// maxChars and maxLines (checked only if maxChars is positive, see Reflow()), or if it is displayed
+// longer than maxDur (checked only if positive; the number of parts is chosen so that their average display
+// duration doesn't exceed maxDur). Pos and Color are preserved.
+// Returns the parts (with text reflowed in the pyramid shape if maxChars is positive), or the subtitle itself
+// if it doesn't need to be split.
+func (s *Subtitle) SplitLong(maxChars, maxLines int, maxDur time.Duration) []*Subtitle {
+	dialogue := s.isDialogue()
+
+	// startsLine tells if words[i] starts a new line: dialogue lines are kept
+	startsLine := func(words []reflowWord, i int) bool {
+		return i == 0 || dialogue && strings.HasPrefix(plainText(words[i].text), "-")
+	}
+
+	// fits tells if the words fit the text limits. Lines are counted the same way as Reflow() breaks them:
+	// the min number of lines is obtained greedily.
+	fits := func(words []reflowWord) bool {
+		if maxChars <= 0 {
+			return true
+		}
+		lines, width := 0, 0 // width is the width of the current line
+		for i, w := range words {
+			if w.width > maxChars {
+				return false
+			}
+			if startsLine(words, i) || width+1+w.width > maxChars {
+				lines, width = lines+1, w.width
+			} else {
+				width += 1 + w.width
+			}
+		}
+		return maxLines <= 0 || lines <= maxLines
+	}
+
+	// reflow returns the (reflowed) lines of the words
+	reflow := func(words []reflowWord) []string {
+		var paragraphs []string
+		for i, w := range words {
+			if startsLine(words, i) {
+				paragraphs = append(paragraphs, w.text)
+			} else {
+				paragraphs[len(paragraphs)-1] += " " + w.text
+			}
+		}
+		if maxChars <= 0 {
+			return balanceTags(paragraphs)
+		}
+		var lines []string
+		for _, p := range paragraphs {
+			part := &Subtitle{Lines: []string{p}}
+			part.Reflow(maxChars, 0, ReflowPyramid)
+			lines = append(lines, part.Lines...)
+		}
+		return balanceTags(lines)
+	}
+
+	words := splitWords(rejoinTagsReplacer.Replace(strings.Join(s.Lines, " ")))
+	if len(words) == 0 {
+		return []*Subtitle{s}
+	}
+	totalWidth := 0
+	for _, w := range words {
+		totalWidth += w.width
+	}
+
+	var parts [][]reflowWord
+	// bestBreak returns the index of the best break of words, preferring breaks resulting in parts that fit
+	bestBreak := func(words []reflowWord) (best int) {
+		bestScore := 0.0
+		for i := 1; i < len(words); i++ {
+			score := breakScore(words, i)
+			if fits(words[:i]) && fits(words[i:]) {
+				score += 10
+			}
+			if best == 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		return
+	}
+	// Split text that doesn't fit
+	var split func(words []reflowWord)
+	split = func(words []reflowWord) {
+		if len(words) == 1 || fits(words) {
+			parts = append(parts, words)
+			return
+		}
+		best := bestBreak(words)
+		split(words[:best])
+		split(words[best:])
+	}
+	split(words)
+
+	// Split more if displayed too long: split the longest part until there are enough parts
+	if maxDur > 0 {
+		for n := int((s.DisplayDuration() + maxDur - 1) / maxDur); len(parts) < n; {
+			longest, longestWidth := -1, 0
+			for i, p := range parts {
+				width := 0
+				for _, w := range p {
+					width += w.width
+				}
+				if len(p) > 1 && width > longestWidth {
+					longest, longestWidth = i, width
+				}
+			}
+			if longest < 0 {
+				break // Nothing more to split
+			}
+			words := parts[longest]
+			best := bestBreak(words)
+			parts = append(parts[:longest], append([][]reflowWord{words[:best], words[best:]}, parts[longest+1:]...)...)
+		}
+	}
+
+	if len(parts) == 1 {
+		if maxChars > 0 {
+			s.Lines = reflow(parts[0])
+		}
+		return []*Subtitle{s}
+	}
+
+	// Formatting open at the end of a part is continued in the next part
+	texts := make([]string, len(parts))
+	for i, p := range parts {
+		texts[i] = strings.Join(reflow(p), "\n")
+	}
+	texts = balanceTags(texts)
+
+	subs := make([]*Subtitle, len(parts))
+	timeIn, width := s.TimeIn, 0
+	for i, p := range parts {
+		for _, w := range p {
+			width += w.width
+		}
+		timeOut := s.TimeOut
+		if i+1 < len(parts) && totalWidth > 0 {
+			timeOut = s.TimeIn + time.Duration(float64(s.DisplayDuration())*float64(width)/float64(totalWidth)).Round(time.Millisecond)
+		}
+		subs[i] = &Subtitle{TimeIn: timeIn, TimeOut: timeOut, Lines: strings.Split(texts[i], "\n"), Pos: s.Pos, Color: s.Color}
+		timeIn = timeOut
+	}
+	return subs
+}
+
+// SplitLong splits subtitles whose text doesn't fit maxChars and maxLines, or which are displayed longer than maxDur
+// into several consecutive subtitles (see Subtitle.SplitLong()), and returns the number of subtitles split.
+func (sp *SubsPack) SplitLong(maxChars, maxLines int, maxDur time.Duration) (split int) {
+	var subs []*Subtitle
+	for _, s := range sp.Subs {
+		parts := s.SplitLong(maxChars, maxLines, maxDur)
+		if len(parts) > 1 {
+			split++
+		}
+		subs = append(subs, parts...)
+	}
+	sp.Subs = subs
+	return
+}
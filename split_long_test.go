@@ -0,0 +1,56 @@
+package srtgears
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitLong(t *testing.T) {
+	cases := []struct {
+		name     string
+		lines    []string
+		maxChars int
+		maxLines int
+		maxDur   time.Duration
+		exp      []string
+	}{
+		{"sentence by duration", []string{"We were there all night. Nobody came."}, 42, 2, 3 * time.Second,
+			// Display time is split by text width (spaces excluded): 20 and 11 of 31
+			[]string{"We were there all night. 10s-13.871s", "Nobody came. 13.871s-16s"}},
+		{"clause by text", []string{"I told you already. It is not here and never was, so stop looking for it everywhere."}, 37, 2, 0,
+			[]string{"I told you already. It/is not here and never was, 10s-13.441s", "so stop looking for it everywhere. 13.441s-16s"}},
+		{"dialogue", []string{"- Where are you going?", "- Out to the garden, why?"}, 30, 1, 0,
+			[]string{"- Where are you going? 10s-12.842s", "- Out to the garden, why? 12.842s-16s"}},
+		{"tags continued", []string{"<i>We were there all night.", "Nobody came, nobody called.</i>"}, 30, 1, 0,
+			[]string{"<i>We were there all night.</i> 10s-12.727s", "<i>Nobody came, nobody called.</i> 12.727s-16s"}},
+		{"fits", []string{"We were there", "all night."}, 42, 2, 7 * time.Second,
+			[]string{"We were there all night. 10s-16s"}},
+	}
+	for _, c := range cases {
+		s := &Subtitle{TimeIn: 10 * time.Second, TimeOut: 16 * time.Second, Lines: c.lines, Pos: Top, Color: "red"}
+		sp := &SubsPack{Subs: s.SplitLong(c.maxChars, c.maxLines, c.maxDur)}
+		if got := timings(sp); !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("[%s] Expected: %q, got: %q", c.name, c.exp, got)
+		}
+		for _, part := range sp.Subs {
+			if part.Pos != Top || part.Color != "red" {
+				t.Errorf("[%s] Expected pos and color to be preserved, got: %v, %s", c.name, part.Pos, part.Color)
+			}
+		}
+	}
+}
+
+func TestSubsPackSplitLong(t *testing.T) {
+	sp := &SubsPack{Subs: []*Subtitle{
+		timedSub(1, 2, "Hi."),
+		timedSub(3, 9, "We were there all night. Nobody came."),
+	}}
+	if split := sp.SplitLong(0, 0, 4*time.Second); split != 1 {
+		t.Errorf("Expected split: %d, got: %d", 1, split)
+	}
+	exp := []string{"Hi. 1s-2s", "We were there all night. 3s-6.871s", "Nobody came. 6.871s-9s"}
+	if got := timings(sp); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Expected: %q, got: %q", exp, got)
+	}
+}
@@ -1,7 +1,11 @@
 /*
 
-This file implements writing the Sub Station Alpha file format (*.ssa).
-It can generate SubRip content from a model.
+This file implements reading and writing the Sub Station Alpha file format (*.ssa).
+It can parse *.ssa files and create model from them.
+And it can also generate Sub Station Alpha content from a model.
+
+The parser is permissive, it honours the "Format:" lines of the sections,
+and unknown sections and lines are skipped.
 
 Format specifications:
 https://en.wikipedia.org/wiki/SubStation_Alpha
@@ -37,8 +41,11 @@ An example SSA file:
 package srtgears
 
 import (
+	"bufio"
+	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -51,6 +58,241 @@ var modelPosToSsaPos = map[Pos]int{
 	BottomLeft: 1, Bottom: 2, BottomRight: 3,
 }
 
+// Mapping between *.ssa Alignment to our model Pos, the inverse of modelPosToSsaPos.
+var ssaPosToModelPos = map[int]Pos{
+	5: TopLeft, 6: Top, 7: TopRight,
+	9: Left, 10: Center, 11: Right,
+	1: BottomLeft, 2: Bottom, 3: BottomRight,
+}
+
+// Default color of subtitles having no color, in BBGGRR format (light gray).
+const ssaDefaultColor = 0xefefef
+
+// Default "Format:" of the styles section, used if the input does not specify one.
+var ssaDefaultStyleFormat = []string{"Name", "Fontname", "Fontsize", "PrimaryColour", "SecondaryColour",
+	"TertiaryColour", "BackColour", "Bold", "Italic", "BorderStyle", "Outline", "Shadow",
+	"Alignment", "MarginL", "MarginR", "MarginV", "AlphaLevel", "Encoding"}
+
+// Default "Format:" of the events section, used if the input does not specify one.
+var ssaDefaultEventFormat = []string{"Marked", "Start", "End", "Style", "Name",
+	"MarginL", "MarginR", "MarginV", "Effect", "Text"}
+
+// ReadSsaFile reads and parses a Sub Station Alpha file (*.ssa) and builds the model from it.
+func ReadSsaFile(name string) (sp *SubsPack, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Reading from file: %s", name)
+	return ReadSsaFrom(f)
+}
+
+// ssaStyle holds the style info we use from a style definition.
+type ssaStyle struct {
+	Pos   Pos    // Subtitle position
+	Color string // Subtitle color, in our model format
+}
+
+// ReadSsaFrom reads and parses a Sub Station Alpha from an io.Reader (*.ssa) and builds the model from it.
+//
+// Since the formats are very similar, Advanced Sub Station Alpha (*.ass) input is also accepted,
+// the styles section tells which one it is.
+func ReadSsaFrom(r io.Reader) (sp *SubsPack, err error) {
+	sp = &SubsPack{}
+	scanner := bufio.NewScanner(r)
+
+	section := ""
+	styleFormat, eventFormat := ssaDefaultStyleFormat, ssaDefaultEventFormat
+	styles := map[string]*ssaStyle{}
+
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if lineNum == 0 {
+			// If BOM is present, strip it off. It's "\uFEFF", which is "\xef\xbb\xbf" in UTF-8
+			if strings.HasPrefix(line, "\xef\xbb\xbf") {
+				line = line[3:]
+			}
+		}
+		lineNum++
+
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' {
+			continue // Empty line or comment
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.ToLower(line)
+			continue
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			debugf("Invalid line %d: %s", lineNum, line)
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+
+		switch section {
+		case "[v4 styles]", "[v4+ styles]":
+			switch key {
+			case "Format":
+				styleFormat = ssaParseFormat(value)
+			case "Style":
+				posMap := ssaPosToModelPos
+				if section == "[v4+ styles]" {
+					posMap = assPosToModelPos
+				}
+				fields := ssaSplitFields(value, styleFormat)
+				styles[ssaStyleName(fields["Name"])] = ssaParseStyle(fields, posMap)
+			}
+		case "[events]":
+			switch key {
+			case "Format":
+				eventFormat = ssaParseFormat(value)
+			case "Dialogue":
+				fields := ssaSplitFields(value, eventFormat)
+				s, err := ssaParseDialogue(fields, styles)
+				if err != nil {
+					debugf("%v in line %d: %s", err, lineNum, line)
+					continue
+				}
+				sp.Subs = append(sp.Subs, s)
+			}
+		}
+	}
+
+	debugf("Loaded %d subtitles.", len(sp.Subs))
+
+	sp.Sort()
+
+	err = scanner.Err()
+	return
+}
+
+// ssaParseFormat parses the value of a "Format:" line, returns the field names.
+func ssaParseFormat(value string) []string {
+	format := strings.Split(value, ",")
+	for i, v := range format {
+		format[i] = strings.TrimSpace(v)
+	}
+	return format
+}
+
+// ssaSplitFields splits the value of a "Style:" or "Dialogue:" line
+// according to the given format, and returns the field values mapped from field names.
+// The last field may contain commas (this is the case with the Text field).
+func ssaSplitFields(value string, format []string) map[string]string {
+	parts := strings.SplitN(value, ",", len(format))
+	fields := make(map[string]string, len(parts))
+	for i, v := range parts {
+		if i < len(format)-1 {
+			v = strings.TrimSpace(v)
+		}
+		fields[format[i]] = v
+	}
+	return fields
+}
+
+// ssaStyleName normalizes a style name. The default style may be referred to as "*Default".
+func ssaStyleName(name string) string {
+	return strings.TrimLeft(strings.TrimSpace(name), "*")
+}
+
+// ssaParseStyle creates an ssaStyle from the fields of a style definition.
+// posMap is used to map the Alignment value to our model Pos.
+func ssaParseStyle(fields map[string]string, posMap map[int]Pos) *ssaStyle {
+	st := &ssaStyle{}
+	if n, err := strconv.Atoi(fields["Alignment"]); err == nil {
+		// Bottom is the default position, which is the same as not specifying it.
+		if p := posMap[n]; p != Bottom {
+			st.Pos = p
+		}
+	}
+	if c, ok := ssaParseColor(fields["PrimaryColour"]); ok && c != ssaDefaultColor {
+		st.Color = colorFromBGR(c)
+	}
+	return st
+}
+
+// ssaParseColor parses an SSA color value. It may be in decimal form, or in hexadecimal
+// form with "&H" prefix (optionally with "&" suffix). The alpha component (if present) is dropped.
+// Returns the color in BBGGRR format.
+func ssaParseColor(value string) (c int, ok bool) {
+	var n int64
+	var err error
+	if v := strings.ToUpper(value); strings.HasPrefix(v, "&H") {
+		n, err = strconv.ParseInt(strings.TrimSuffix(v[2:], "&"), 16, 64)
+	} else {
+		n, err = strconv.ParseInt(value, 10, 64)
+	}
+	if err != nil {
+		return
+	}
+	return int(n & 0xffffff), true
+}
+
+// colorFromBGR converts a color from BBGGRR format to our model format (HTML #RRGGBB).
+func colorFromBGR(c int) string {
+	return fmt.Sprintf("#%02x%02x%02x", c&0xff, (c>>8)&0xff, (c>>16)&0xff)
+}
+
+// Regexp pattern to parse SSA timestamps, e.g. "0:00:01.18".
+// Number of digits of hours and the fraction are limited so they can't overflow.
+var ssaTimePattern = regexp.MustCompile(`^(\d{1,6}):(\d\d):(\d\d)[\.:](\d{1,9})$`)
+
+// ssaParseTime parses an SSA timestamp, e.g. "0:00:01.18".
+func ssaParseTime(value string) (t time.Duration, ok bool) {
+	parts := ssaTimePattern.FindStringSubmatch(value)
+	if len(parts) == 0 {
+		return
+	}
+
+	get := func(idx int) time.Duration {
+		n, err := strconv.ParseInt(parts[idx], 10, 64)
+		if err != nil {
+			panic(err) // This shouldn't happen as only a limited number of digits are matched.
+		}
+		return time.Duration(n)
+	}
+
+	// Fraction is usually hundredths of a second, but handle any number of digits
+	frac := get(4) * time.Second
+	for i := 0; i < len(parts[4]); i++ {
+		frac /= 10
+	}
+
+	return time.Hour*get(1) + time.Minute*get(2) + time.Second*get(3) + frac, true
+}
+
+// Pattern used to split text into lines ("\N" is a hard line break, "\n" is a soft one).
+var ssaLineBreakPattern = regexp.MustCompile(`\\[Nn]`)
+
+// ssaParseDialogue creates a Subtitle from the fields of a dialogue event.
+func ssaParseDialogue(fields map[string]string, styles map[string]*ssaStyle) (*Subtitle, error) {
+	s := &Subtitle{}
+
+	var ok bool
+	if s.TimeIn, ok = ssaParseTime(fields["Start"]); !ok {
+		return nil, fmt.Errorf("Invalid start time")
+	}
+	if s.TimeOut, ok = ssaParseTime(fields["End"]); !ok {
+		return nil, fmt.Errorf("Invalid end time")
+	}
+	if s.TimeOut <= s.TimeIn {
+		debugf("Start >= End, text won't be visible: %s", fields["Text"])
+	}
+
+	if st := styles[ssaStyleName(fields["Style"])]; st != nil {
+		s.Pos, s.Color = st.Pos, st.Color
+	}
+
+	s.Lines = ssaLineBreakPattern.Split(fields["Text"], -1)
+
+	return s, nil
+}
+
 // WriteSsaFile generates Sub Station Alpha format (*.ssa) and writes it to a file.
 func WriteSsaFile(name string, sp *SubsPack) (err error) {
 	f, err := os.Create(name)
@@ -70,20 +312,29 @@ type styleKey struct {
 }
 
 // keyFromSub creates a style key containing the style info of the subtitle.
-func keyFromSub(s *Subtitle) (k styleKey) {
+// posMap is used to map the position to the Alignment value of the target format.
+func keyFromSub(s *Subtitle, posMap map[Pos]int) (k styleKey) {
 	pos := s.Pos
 	if pos == PosNotSpecified {
 		pos = Bottom // Assign default position
 	}
-	k.Pos = modelPosToSsaPos[pos]
+	k.Pos = posMap[pos]
 
-	color := s.Color
+	var ok bool
+	if k.Color, ok = colorToBGR(s.Color); !ok {
+		// Unknown / unspecified color, assign a default value
+		k.Color = ssaDefaultColor
+	}
 
+	return
+}
+
+// colorToBGR converts a color of our model (HTML RRGGBB format or a color name) to BBGGRR format.
+// Returns false if the color is unspecified or unknown.
+func colorToBGR(color string) (c int, ok bool) {
 	for {
 		if color == "" {
-			// Unknown / unspecified color, assign a default value
-			k.Color = 0xefefef // light gray
-			break
+			return
 		}
 		if color[0] == '#' {
 			color = color[1:]
@@ -92,18 +343,43 @@ func keyFromSub(s *Subtitle) (k styleKey) {
 		if n, err := strconv.ParseInt(color, 16, 64); err == nil {
 			// It's a hex form (RRGGBB). Switch bytes.
 			v := int(n)
-			k.Color = (v & 0xff0000) >> 16
-			k.Color |= v & 0x00ff00
-			k.Color |= v & 0x0000ff << 16
-			break
+			c = (v & 0xff0000) >> 16
+			c |= v & 0x00ff00
+			c |= v & 0x0000ff << 16
+			return c, true
 		}
 		// Not a hex form, try the standard color names
 		color = htmlColorRGB[strings.ToLower(color)] // If unknown, will be "" and handled in next iteration
 	}
+}
 
+// collectStyles loops over all subtitles to determine what styles we have.
+// Returns the style keys of the subtitles, the unique style keys mapped to style names,
+// and the unique style keys in order of their first appearance.
+func collectStyles(sp *SubsPack, posMap map[Pos]int) (styleKeys []styleKey, stylesMap map[styleKey]string, styles []styleKey) {
+	styleKeys = make([]styleKey, len(sp.Subs)) // Store calculated style keys, we will need to interate over subs once more
+	stylesMap = map[styleKey]string{}          // Unique style keys
+	styles = []styleKey{}                      // Maintain order of unique style keys for generation
+	for i, s := range sp.Subs {
+		styleKeys[i] = keyFromSub(s, posMap)
+		if _, ok := stylesMap[styleKeys[i]]; !ok {
+			// new style
+			styles = append(styles, styleKeys[i])
+			stylesMap[styleKeys[i]] = strconv.Itoa(len(styles))
+		}
+	}
 	return
 }
 
+// prSsaTime prints a timestamp in the form used by SSA and ASS, e.g. "0:00:01.18".
+func prSsaTime(wr *writer, t time.Duration) {
+	hour := t / time.Hour
+	min := (t % time.Hour) / time.Minute
+	sec := (t % time.Minute) / time.Second
+	ms := (t % time.Second) / time.Millisecond
+	wr.prf("%d:%02d:%02d.%02d", hour, min, sec, ms/10)
+}
+
 // WriteSsaTo generates Sub Station Alpha format (*.ssa) and writes it to an io.Writer.
 func WriteSsaTo(w io.Writer, sp *SubsPack) (err error) {
 	wr := &writer{w: w}
@@ -127,18 +403,7 @@ func WriteSsaTo(w io.Writer, sp *SubsPack) (err error) {
 	wr.prn()
 	wr.prn("[V4 Styles]")
 	wr.prn("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, TertiaryColour, BackColour, Bold, Italic, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, AlphaLevel, Encoding")
-	// Loop over all subtitles to determine what styles we have
-	styleKeys := make([]styleKey, len(sp.Subs)) // Store calculated style keys, we will need to interate over subs once more
-	stylesMap := map[styleKey]string{}          // Unique style keys
-	styles := []styleKey{}                      // Maintain order of unique style keys for generation
-	for i, s := range sp.Subs {
-		styleKeys[i] = keyFromSub(s)
-		if _, ok := stylesMap[styleKeys[i]]; !ok {
-			// new style
-			styles = append(styles, styleKeys[i])
-			stylesMap[styleKeys[i]] = strconv.Itoa(len(styles))
-		}
-	}
+	styleKeys, stylesMap, styles := collectStyles(sp, modelPosToSsaPos)
 	// Now generate style definitions
 	for _, v := range styles {
 		wr.prf("Style: %s, Arial,28,%d,%d,%d,-2147483640,-1,0,1,1,2,%d,30,30,30,0,0",
@@ -151,23 +416,15 @@ func WriteSsaTo(w io.Writer, sp *SubsPack) (err error) {
 	wr.prn("[Events]")
 	wr.prn("Format: Marked, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text")
 
-	printTime := func(t time.Duration) {
-		hour := t / time.Hour
-		min := (t % time.Hour) / time.Minute
-		sec := (t % time.Minute) / time.Second
-		ms := (t % time.Second) / time.Millisecond
-		wr.prf("%d:%02d:%02d.%02d", hour, min, sec, ms/10)
-	}
-
 	for i, s := range sp.Subs {
 		if wr.err != nil {
 			break
 		}
 
 		wr.pr("Dialogue: Marked=0,")
-		printTime(s.TimeIn)
+		prSsaTime(wr, s.TimeIn)
 		wr.pr(",")
-		printTime(s.TimeOut)
+		prSsaTime(wr, s.TimeOut)
 		wr.pr(",", stylesMap[styleKeys[i]], ",NA,0000,0000,0000,,")
 
 		// Texts
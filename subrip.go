@@ -9,6 +9,8 @@ https://en.wikipedia.org/wiki/SubRip
 http://www.matroska.org/technical/specs/subtitles/srt.html
 
 The parser is permissive, it tries to parse the input even if it does not conform to the specification.
+Problems can be obtained as ParseWarnings, or non-conforming input can be rejected (strict mode),
+see ReadSrtFromOpts().
 
 Unofficial extensions are also supported and used.
 
@@ -35,6 +37,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // Mapping between *.srt pos to our model Pos for the {\anX} variant
@@ -63,6 +66,19 @@ func ReadSrtFile(name string) (sp *SubsPack, err error) {
 	return ReadSrtFrom(f)
 }
 
+// ReadSrtFileOpts reads and parses a SubRip file (*.srt) using the given options and builds the model from it.
+// See ReadSrtFromOpts() for details.
+func ReadSrtFileOpts(name string, opts ParseOptions) (sp *SubsPack, warnings []ParseWarning, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Reading from file: %s", name)
+	return ReadSrtFromOpts(f, opts)
+}
+
 // Regexp pattern to validate sequence number lines
 var seqNumPattern = regexp.MustCompile(`^\s*\d+\s*$`)
 
@@ -73,7 +89,19 @@ var starterFontPattern = regexp.MustCompile(`^\s*<\s*font\s+color\s*=\s*['"]?([^
 var fontClosingPattern = regexp.MustCompile(`<\s*/\s*font\s*>`)
 
 // ReadSrtFrom reads and parses a SubRip from an io.Reader (*.srt) and builds the model from it.
+// Problems found in the input are logged (if Debug is set).
 func ReadSrtFrom(r io.Reader) (sp *SubsPack, err error) {
+	sp, warnings, err := ReadSrtFromOpts(r, ParseOptions{})
+	for _, pw := range warnings {
+		debugf("%s", pw)
+	}
+	return
+}
+
+// ReadSrtFromOpts reads and parses a SubRip from an io.Reader (*.srt) using the given options and builds the model from it.
+// Problems found in the input are returned as warnings. In strict mode if there are problems,
+// sp is nil and err is a *ParseError listing the problems.
+func ReadSrtFromOpts(r io.Reader, opts ParseOptions) (sp *SubsPack, warnings []ParseWarning, err error) {
 	sp = &SubsPack{}
 	scanner := bufio.NewScanner(r)
 	phase := 0
@@ -125,16 +153,17 @@ func ReadSrtFrom(r io.Reader) (sp *SubsPack, err error) {
 			if line == "" {
 				break // If multiple empty line separates, just ignore them
 			}
-			if Debug {
-				if !seqNumPattern.MatchString(line) {
-					debugf("Invalid sequence number in line %d: %s", lineNum, line)
-				}
+			if !seqNumPattern.MatchString(line) {
+				col := strings.IndexFunc(line, func(r rune) bool { return (r < '0' || r > '9') && r != ' ' && r != '\t' })
+				warnings = append(warnings, ParseWarning{Line: lineNum, Col: colOf(line, col), Category: InvalidSeqNum, Text: line})
 			}
 			// discard seq#, we generate sequence numbers when writing
 			s = &Subtitle{}
 			phase++
 		case 1: // wanting timestamps
-			parseTimestamps(s, line, lineNum)
+			if pw := parseTimestamps(s, line, lineNum); pw != nil {
+				warnings = append(warnings, *pw)
+			}
 			phase++
 		case 2: // wanting subtitle lines
 			if line == "" {
@@ -150,14 +179,30 @@ func ReadSrtFrom(r io.Reader) (sp *SubsPack, err error) {
 		addSub()
 	}
 
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	if opts.Strict && len(warnings) > 0 {
+		return nil, warnings, &ParseError{Warnings: warnings}
+	}
+
 	debugf("Loaded %d subtitles.", len(sp.Subs))
 
 	sp.Sort()
 
-	err = scanner.Err()
 	return
 }
 
+// colOf returns the 1-based column (in characters) of the byte index idx in line.
+// Negative idx means the beginning of the line.
+func colOf(line string, idx int) int {
+	if idx < 0 {
+		return 1
+	}
+	return utf8.RuneCountInString(line[:idx]) + 1
+}
+
 // Regexp pattern to extract data from timestamp lines.
 // Very permissive, for example also accepts this line:
 //
@@ -166,18 +211,19 @@ var timestampsPattern = regexp.MustCompile(`(\d\d):(\d\d):(\d\d)[,\.](\d\d\d)\s*
 
 //                                            0 0 :  0 0 :  0 0  ,     0 0 0    -->     0 0 :  0 0 :  0 0  ,     0 0 0
 
-// parseTimestamps parses a timestamp line
-func parseTimestamps(s *Subtitle, line string, lineNum int) {
+// parseTimestamps parses a timestamp line.
+// Returns a warning if the line is invalid.
+func parseTimestamps(s *Subtitle, line string, lineNum int) *ParseWarning {
 	// Example: 00:02:20,476 --> 00:02:22,501
-	parts := timestampsPattern.FindStringSubmatch(line)
-	if len(parts) == 0 {
+	loc := timestampsPattern.FindStringSubmatchIndex(line)
+	if loc == nil {
 		// No match, invalid timestamp line
-		debugf("Invalid timestamp in line %d: %s", lineNum, line)
-		return
+		col := strings.IndexFunc(line, func(r rune) bool { return r != ' ' && r != '\t' })
+		return &ParseWarning{Line: lineNum, Col: colOf(line, col), Category: InvalidTimestamp, Text: line}
 	}
 
 	get := func(idx int) time.Duration {
-		n, err := strconv.ParseInt(parts[idx], 10, 64)
+		n, err := strconv.ParseInt(line[loc[idx*2]:loc[idx*2+1]], 10, 64)
 		if err != nil {
 			panic(err) // This shouldn't happen as only digits are matched.
 		}
@@ -189,8 +235,9 @@ func parseTimestamps(s *Subtitle, line string, lineNum int) {
 	s.TimeOut = time.Hour*get(5) + time.Minute*get(6) + time.Second*get(7) + time.Millisecond*get(8)
 
 	if s.TimeOut <= s.TimeIn {
-		debugf("Time1 >= Time2, text won't be visible in line %d: %s", lineNum, line)
+		return &ParseWarning{Line: lineNum, Col: colOf(line, loc[10]), Category: InvalidTimeOrder, Text: line}
 	}
+	return nil
 }
 
 // WriteSrtFile generates SubRip format (*.srt) and writes it to a file.
@@ -17,6 +17,14 @@ import (
 // a collection of Subtitles and other meta info.
 type SubsPack struct {
 	Subs []*Subtitle
+
+	// FrameRate is the frame rate (frames per second) the subtitles were read with
+	// if they were read from a frame based format, 0 otherwise.
+	FrameRate float64
+
+	// VttBlocks are the NOTE, STYLE and REGION blocks of a WebVTT input,
+	// preserved so they can be written back when generating WebVTT.
+	VttBlocks []string
 }
 
 // SortSubtitles is a type that implements sorting
@@ -62,15 +70,9 @@ func (sp *SubsPack) SetColor(color string) {
 
 // RemoveHI removes hearing impaired lines from subtitles
 // (such as "[PHONE RINGING]" or "(phone ringing)").
+// See RemoveHIModes() for more removal modes.
 func (sp *SubsPack) RemoveHI() {
-	for i := len(sp.Subs) - 1; i >= 0; i-- {
-		s := sp.Subs[i]
-		s.RemoveHI()
-		if len(s.Lines) == 0 {
-			// Can be removed completely
-			sp.Subs = append(sp.Subs[:i], sp.Subs[i+1:]...)
-		}
-	}
+	sp.RemoveHIModes(HILines)
 }
 
 // Concatenate concatenates another SubsPack to this.
@@ -116,23 +118,124 @@ func (sp *SubsPack) Merge(sp2 *SubsPack) {
 //
 // Useful to create 2 subtitles if movie is present in 2 parts but subtitle is for one.
 func (sp *SubsPack) Split(at time.Duration) (sp2 *SubsPack) {
-	sp2 = &SubsPack{}
+	return sp.SplitN([]time.Duration{at}, false)[1]
+}
 
+// SplitN splits this SubsPack into len(ats)+1 parts at the specified (increasing) times,
+// and returns the parts. The first part remains in this, timestamps of the other parts are
+// shifted so they start at their split time.
+//
+// Subtitles straddling a split time remain in the part they start in, unless clip is true,
+// in which case they are clipped at the split time, and the rest is added to the next part.
+//
+// Useful to create subtitles for a movie present in multiple parts (e.g. a multi-disc release).
+func (sp *SubsPack) SplitN(ats []time.Duration, clip bool) (parts []*SubsPack) {
 	subs := sp.Subs
-	idx := sort.Search(len(subs), func(i int) bool {
-		return subs[i].TimeIn >= at
-	})
-
-	sp2.Subs = make([]*Subtitle, len(subs)-idx)
-	copy(sp2.Subs, subs[idx:])
-	sp.Subs = subs[:idx]
+	var carry []*Subtitle // Clipped rests of subtitles straddling the previous split time
+	for i := 0; i <= len(ats); i++ {
+		idx := len(subs)
+		if i < len(ats) {
+			at := ats[i]
+			idx = sort.Search(len(subs), func(j int) bool {
+				return subs[j].TimeIn >= at
+			})
+		}
+		part := &SubsPack{FrameRate: sp.FrameRate, Subs: append(carry, subs[:idx]...)}
+		subs, carry = subs[idx:], nil
+
+		if clip && i < len(ats) {
+			for _, s := range part.Subs {
+				if s.TimeOut > ats[i] {
+					s2 := *s
+					s2.Lines = append([]string(nil), s.Lines...)
+					s2.TimeIn, s.TimeOut = ats[i], ats[i]
+					carry = append(carry, &s2)
+				}
+			}
+		}
 
-	// Shift splitted subs:
-	sp2.Shift(-at)
+		// Shift splitted subs:
+		if i > 0 {
+			part.Shift(-ats[i-1])
+		}
+		parts = append(parts, part)
+	}
 
+	sp.Subs = parts[0].Subs
+	parts[0] = sp
 	return
 }
 
+// mapTimesClip maps the timestamps of all subtitles with f, and removes
+// subtitles not displayed anymore (their display duration became zero).
+func (sp *SubsPack) mapTimesClip(f func(t time.Duration) time.Duration) {
+	subs := sp.Subs[:0]
+	for _, s := range sp.Subs {
+		s.TimeIn, s.TimeOut = f(s.TimeIn), f(s.TimeOut)
+		if s.TimeOut > s.TimeIn {
+			subs = append(subs, s)
+		}
+	}
+	sp.Subs = subs
+}
+
+// Cut removes the time range [from, to) (e.g. a deleted scene), and pulls subtitles after it back.
+// Subtitles inside the range are removed, subtitles straddling its boundaries are clipped.
+func (sp *SubsPack) Cut(from, to time.Duration) {
+	if to <= from {
+		return
+	}
+	sp.mapTimesClip(func(t time.Duration) time.Duration {
+		switch {
+		case t < from:
+			return t
+		case t < to:
+			return from
+		}
+		return t - (to - from)
+	})
+}
+
+// InsertGap inserts a gap of duration d at the given time (e.g. for an intro or an ad break),
+// and pushes subtitles after it forward.
+// Subtitles straddling at are split into 2 parts: before and after the gap.
+func (sp *SubsPack) InsertGap(at, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	var subs []*Subtitle
+	for _, s := range sp.Subs {
+		switch {
+		case s.TimeIn >= at:
+			s.Shift(d)
+		case s.TimeOut > at:
+			s2 := *s
+			s2.Lines = append([]string(nil), s.Lines...)
+			s2.TimeIn, s2.TimeOut = at+d, s.TimeOut+d
+			s.TimeOut = at
+			subs = append(subs, s, &s2)
+			continue
+		}
+		subs = append(subs, s)
+	}
+	sp.Subs = subs
+	sp.Sort()
+}
+
+// Extract keeps only the time range [from, to) (e.g. a clip), and rebases it to zero.
+// Subtitles outside of the range are removed, subtitles straddling its boundaries are clipped.
+func (sp *SubsPack) Extract(from, to time.Duration) {
+	sp.mapTimesClip(func(t time.Duration) time.Duration {
+		switch {
+		case t < from:
+			t = from
+		case t > to:
+			t = to
+		}
+		return t - from
+	})
+}
+
 // RemoveHTML removes HTML formatting from all subtitles.
 func (sp *SubsPack) RemoveHTML() {
 	for _, s := range sp.Subs {
@@ -154,6 +257,124 @@ func (sp *SubsPack) Lengthen(factor float64) {
 	}
 }
 
+// NormalizeTiming enforces display duration limits and a minimum gap between subtitles,
+// and returns the number of subtitles whose timing was changed. Zero values are not enforced.
+//
+// Subtitles shorter than minDur are lengthened (but never past the next subtitle's TimeIn minus minGap),
+// subtitles longer than maxDur are shortened, and if minGap is positive, subtitles ending less than minGap
+// before the next subtitle are shortened (overlaps are removed too). Subtitles starting at (nearly) the same time
+// as the next one are not shortened to make a gap.
+//
+// The next subtitle is the next one of the same track (position, see Merge()), so the tracks of
+// merged dual subtitles are timed independently.
+func (sp *SubsPack) NormalizeTiming(minDur, maxDur, minGap time.Duration) (changed int) {
+	subs := make([]*Subtitle, len(sp.Subs))
+	copy(subs, sp.Subs)
+	sort.Stable(SortSubtitles(subs))
+
+	for i, s := range subs {
+		timeOut := s.TimeOut
+		next := nextInTrack(subs, i)
+		if maxDur > 0 && s.DisplayDuration() > maxDur {
+			s.TimeOut = s.TimeIn + maxDur
+		}
+		if minDur > 0 && s.DisplayDuration() < minDur {
+			newOut := s.TimeIn + minDur
+			if next != nil {
+				if limit := next.TimeIn - minGap; newOut > limit {
+					newOut = limit
+				}
+			}
+			if newOut > s.TimeOut {
+				s.TimeOut = newOut
+			}
+		}
+		if minGap > 0 && next != nil {
+			if limit := next.TimeIn - minGap; s.TimeOut > limit && limit > s.TimeIn {
+				s.TimeOut = limit
+			}
+		}
+		if s.TimeOut != timeOut {
+			changed++
+		}
+	}
+	return
+}
+
+// nextInTrack returns the subtitle following subs[i] in the same track (see trackPos()), nil if there is none.
+// subs must be sorted.
+func nextInTrack(subs []*Subtitle, i int) *Subtitle {
+	for _, s := range subs[i+1:] {
+		if trackPos(s.Pos) == trackPos(subs[i].Pos) {
+			return s
+		}
+	}
+	return nil
+}
+
+// ReadingSpeed specifies the reading speed used to compute display durations (see RetimeByReadingSpeed()).
+// If both CPS and WPM are specified, the longer duration is used.
+type ReadingSpeed struct {
+	CPS float64 // Characters (spaces included) per second, 0 if not used
+	WPM float64 // Words per minute, 0 if not used
+
+	MinDuration time.Duration // Min display duration, 0 if not enforced
+	MaxDuration time.Duration // Max display duration, 0 if not enforced
+}
+
+// RetimeByReadingSpeed recomputes the display duration (TimeOut) of the subtitles from their text
+// (formatting and controls excluded) and the reading speed, bounded by the min / max durations of rs.
+// Subtitles are never extended past the next subtitle's TimeIn (of the same track, see NormalizeTiming()).
+// Subtitles are left unchanged if neither CPS nor WPM is positive.
+func (sp *SubsPack) RetimeByReadingSpeed(rs *ReadingSpeed) {
+	if rs.CPS <= 0 && rs.WPM <= 0 {
+		return
+	}
+
+	subs := make([]*Subtitle, len(sp.Subs))
+	copy(subs, sp.Subs)
+	sort.Stable(SortSubtitles(subs))
+
+	for i, s := range subs {
+		chars, _, words := countText(s.plainLines())
+		var dur time.Duration
+		if rs.CPS > 0 {
+			dur = time.Duration(float64(chars) / rs.CPS * float64(time.Second))
+		}
+		if rs.WPM > 0 {
+			if d := time.Duration(float64(words) / rs.WPM * float64(time.Minute)); d > dur {
+				dur = d
+			}
+		}
+		if rs.MinDuration > 0 && dur < rs.MinDuration {
+			dur = rs.MinDuration
+		}
+		if rs.MaxDuration > 0 && dur > rs.MaxDuration {
+			dur = rs.MaxDuration
+		}
+
+		s.TimeOut = s.TimeIn + dur.Round(time.Millisecond)
+		if next := nextInTrack(subs, i); next != nil {
+			if s.TimeOut > next.TimeIn && next.TimeIn > s.TimeIn {
+				s.TimeOut = next.TimeIn
+			}
+		}
+	}
+}
+
+// countText counts the characters (spaces included), the non-space characters and the words of the lines.
+func countText(lines []string) (chars, charsNoSpace, words int) {
+	for _, line := range lines {
+		chars += utf8.RuneCountInString(line)
+		fields := strings.Fields(line)
+		words += len(fields)
+		for _, field := range fields {
+			charsNoSpace += utf8.RuneCountInString(field)
+		}
+	}
+	return
+}
+
 // SubsStats is statistics that can be gathered from a SubsPack.
 type SubsStats struct {
 	Subs                      int           // Total number of subs.
@@ -191,14 +412,10 @@ func (sp *SubsPack) Stats() *SubsStats {
 			ss.HTMLs++
 		}
 
-		for _, v := range s.Lines {
-			ss.Chars += utf8.RuneCountInString(v)
-			fields := strings.Fields(v)
-			ss.Words += len(fields)
-			for _, v2 := range fields {
-				ss.CharsNoSpace += utf8.RuneCountInString(v2)
-			}
-		}
+		chars, charsNoSpace, words := countText(s.Lines)
+		ss.Chars += chars
+		ss.CharsNoSpace += charsNoSpace
+		ss.Words += words
 
 		if s.RemoveHI() {
 			ss.HIs++
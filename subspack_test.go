@@ -0,0 +1,32 @@
+package srtgears
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTiming(t *testing.T) {
+	cases := []struct {
+		name                string
+		minDur, maxDur, gap time.Duration
+		exp                 []string
+		expChanged          int
+	}{
+		{"minGap", 0, 0, 100 * time.Millisecond, []string{"a 1s-2.9s", "top 2s-2.5s", "b 3s-4s"}, 1},
+		{"minDur", 3 * time.Second, 0, 0, []string{"a 1s-3.5s", "top 2s-5s", "b 3s-6s"}, 2},
+		{"maxDur", 0, 1500 * time.Millisecond, 0, []string{"a 1s-2.5s", "top 2s-2.5s", "b 3s-4s"}, 1},
+	}
+	for _, c := range cases {
+		// The top track of merged dual subtitles does not limit the bottom one
+		sp := &SubsPack{Subs: []*Subtitle{timedSub(1, 3.5, "a"), timedSub(3, 4, "b")}}
+		sp.Merge(&SubsPack{Subs: []*Subtitle{timedSub(2, 2.5, "top")}})
+
+		if changed := sp.NormalizeTiming(c.minDur, c.maxDur, c.gap); changed != c.expChanged {
+			t.Errorf("[%s] Expected changed: %d, got: %d", c.name, c.expChanged, changed)
+		}
+		if got := timings(sp); !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("[%s] Expected: %v, got: %v", c.name, c.exp, got)
+		}
+	}
+}
@@ -8,6 +8,7 @@ package srtgears
 
 import (
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -29,6 +30,23 @@ const (
 	TopRight
 )
 
+// Our model Pos by rows (bottom, middle, top) and columns (left, center, right).
+// Useful for formats that specify vertical and horizontal alignment separately.
+var posGrid = [3][3]Pos{
+	{BottomLeft, Bottom, BottomRight},
+	{Left, Center, Right},
+	{TopLeft, Top, TopRight},
+}
+
+// trackPos returns the position identifying the track of a subtitle (e.g. of merged dual subtitles):
+// subtitles of different tracks may overlap. Not specified is the same as bottom.
+func trackPos(p Pos) Pos {
+	if p == PosNotSpecified {
+		return Bottom
+	}
+	return p
+}
+
 // Subtitle represents 1 subtitle, 1 displayable text (which may be broken into multiple lines).
 type Subtitle struct {
 	TimeIn  time.Duration // Timestamp when subtitle appears
@@ -46,23 +64,12 @@ func (s *Subtitle) DisplayDuration() time.Duration {
 // RemoveHI removes hearing impaired lines
 // (such as "[PHONE RINGING]" or "(phone ringing)").
 // Returns true if HI lines were present.
+// See RemoveHIModes() for more removal modes.
 func (s *Subtitle) RemoveHI() (remove bool) {
 	// It may be just some (e.g. first) lines are hearing impaired.
-	for i := len(s.Lines) - 1; i >= 0; i-- {
-		line := s.Lines[i]
-		// Check without HTML formatting to recognize and remove these:
-		// "<i>[PHONE RINGING]</i>"
-		line = htmlPattern.ReplaceAllString(line, "")
-		if len(line) == 0 {
-			continue
-		}
-		first, last := line[0], line[len(line)-1]
-		if first == '[' && last == ']' || first == '(' && last == ')' {
-			remove = true
-			s.Lines = append(s.Lines[:i], s.Lines[i+1:]...)
-		}
-	}
-	return
+	// Lines are checked without formatting to recognize and remove these:
+	// "<i>[PHONE RINGING]</i>"
+	return s.RemoveHIModes(HILines)
 }
 
 // Shift shifts the subtitle with the specified delta.
@@ -93,6 +100,13 @@ func (s *Subtitle) Lengthen(factor float64) {
 // Pattern used to remove HTML formatting
 var htmlPattern = regexp.MustCompile(`<[^>]+>`)
 
+// Pattern of the formatting HTML tags: <i>, <b>, <u> and <font>, opening or closing.
+// Submatches are the closing slash, the tag name and the attributes.
+var formatTagPattern = regexp.MustCompile(`(?i)^<\s*(/?)\s*(i|b|u|font)\b([^>]*)>$`)
+
+// Pattern of the color attribute in <font> tags.
+var fontColorPattern = regexp.MustCompile(`(?i)color\s*=\s*['"]?([^'"\s>]*)`)
+
 // RemoveHTML removes HTML formatting.
 // Returns true if HTML formatting was present.
 func (s *Subtitle) RemoveHTML() (removed bool) {
@@ -109,6 +123,9 @@ func (s *Subtitle) RemoveHTML() (removed bool) {
 // Pattern used to remove controls such as {\anX} (or {\aY}), {\pos(x,y)}.
 var controlPattern = regexp.MustCompile(`^{\\[^}]*}`)
 
+// Pattern used to find controls such as {\anX} (or {\aY}), {\pos(x,y)} anywhere.
+var anyControlPattern = regexp.MustCompile(`{\\[^}]*}`)
+
 // RemoveControl removes controls such as {\anX} (or {\aY}), {\pos(x,y)}.
 // Returns true if controls were present.
 func (s *Subtitle) RemoveControl() (removed bool) {
@@ -121,3 +138,30 @@ func (s *Subtitle) RemoveControl() (removed bool) {
 	s.Pos = PosNotSpecified
 	return
 }
+
+// plainLines returns the lines of the subtitle with formatting and controls removed.
+func (s *Subtitle) plainLines() []string {
+	lines := make([]string, len(s.Lines))
+	for i, line := range s.Lines {
+		lines[i] = plainText(line)
+	}
+	return lines
+}
+
+// isDialogue tells if the subtitle is a dialogue: it has multiple lines, all starting with a dash.
+func (s *Subtitle) isDialogue() bool {
+	if len(s.Lines) < 2 {
+		return false
+	}
+	for _, line := range s.plainLines() {
+		if !strings.HasPrefix(strings.TrimSpace(line), "-") {
+			return false
+		}
+	}
+	return true
+}
+
+// plainText returns the text with formatting and controls removed.
+func plainText(text string) string {
+	return htmlPattern.ReplaceAllString(anyControlPattern.ReplaceAllString(text, ""), "")
+}
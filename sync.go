@@ -0,0 +1,143 @@
+/*
+
+This file implements resynchronizing subtitles to reference timestamps.
+
+Two-point sync: if 2 reference points are known (e.g. subtitle #12 should appear at 00:01:05,200
+and subtitle #880 at 01:42:10,050), the linear mapping (scale and shift) is derived from them
+and applied to all timestamps.
+
+Multi-point sync: subtitles of a different cut (extra scenes, removed commercials) drift non-uniformly.
+Using any number of reference points, timestamps are mapped by a piecewise-linear function
+between the points. Outside of the points the mapping is extrapolated (see Extrapolation).
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// mapTimes applies the mapping function to the timestamps of the subtitle.
+// Timestamps are rounded to milliseconds, and are not allowed to be negative.
+func (s *Subtitle) mapTimes(f func(t time.Duration) time.Duration) {
+	m := func(t time.Duration) time.Duration {
+		if t = f(t).Round(time.Millisecond); t < 0 {
+			t = 0
+		}
+		return t
+	}
+	s.TimeIn, s.TimeOut = m(s.TimeIn), m(s.TimeOut)
+}
+
+// linearMap returns the linear mapping which maps a1 to b1 and a2 to b2.
+func linearMap(a1, a2, b1, b2 time.Duration) func(t time.Duration) time.Duration {
+	factor := float64(b2-b1) / float64(a2-a1)
+	return func(t time.Duration) time.Duration {
+		return b1 + time.Duration(float64(t-a1)*factor)
+	}
+}
+
+// SyncTwoPoints resyncs the subtitles using 2 reference points: timestamp a1 is moved to b1
+// and a2 is moved to b2, and all timestamps (both TimeIn and TimeOut) are mapped linearly
+// (so display durations are scaled too).
+func (sp *SubsPack) SyncTwoPoints(a1, a2, b1, b2 time.Duration) error {
+	return sp.SyncPoints([]SyncPoint{{a1, b1}, {a2, b2}}, ExtrapolateLinear)
+}
+
+// SyncTwoSubs resyncs the subtitles using 2 reference subtitles: subtitle of index i1
+// should appear at b1, and subtitle of index i2 should appear at b2.
+// See SyncTwoPoints() for details.
+func (sp *SubsPack) SyncTwoSubs(i1 int, b1 time.Duration, i2 int, b2 time.Duration) error {
+	for _, i := range []int{i1, i2} {
+		if i < 0 || i >= len(sp.Subs) {
+			return fmt.Errorf("Invalid subtitle index: %d", i)
+		}
+	}
+	return sp.SyncTwoPoints(sp.Subs[i1].TimeIn, sp.Subs[i2].TimeIn, b1, b2)
+}
+
+// SyncPoint is a reference point of syncing: the timestamp From is to be moved to To.
+type SyncPoint struct {
+	From time.Duration // Original timestamp
+	To   time.Duration // Target timestamp
+}
+
+// Extrapolation tells how timestamps outside of the sync points (before the first and after the last) are mapped.
+type Extrapolation int
+
+// Extrapolation modes.
+const (
+	// ExtrapolateShift shifts timestamps by the offset of the nearest sync point.
+	ExtrapolateShift Extrapolation = iota
+	// ExtrapolateLinear continues the mapping of the nearest segment (between the first 2 or last 2 sync points).
+	ExtrapolateLinear
+	// ExtrapolateNone leaves timestamps unchanged (which results in a discontinuity at the first and last sync points).
+	ExtrapolateNone
+)
+
+// SyncPoints resyncs the subtitles using any number of reference points: timestamps are mapped
+// by a piecewise-linear function between the points, and outside of them as specified by extrap.
+// Both TimeIn and TimeOut are mapped (so display durations are scaled too).
+// The points are sorted by From; From values must be different, and To values must increase with From.
+func (sp *SubsPack) SyncPoints(points []SyncPoint, extrap Extrapolation) error {
+	f, err := syncPointsMap(points, extrap)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sp.Subs {
+		s.mapTimes(f)
+	}
+	return nil
+}
+
+// syncPointsMap returns the piecewise-linear mapping defined by the sync points (see SyncPoints()).
+func syncPointsMap(points []SyncPoint, extrap Extrapolation) (func(t time.Duration) time.Duration, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("No sync points specified")
+	}
+	points = append([]SyncPoint(nil), points...)
+	sort.Slice(points, func(i, j int) bool { return points[i].From < points[j].From })
+	for i := 1; i < len(points); i++ {
+		if points[i].From == points[i-1].From {
+			return nil, fmt.Errorf("Sync points must be different: %v", points[i].From)
+		}
+		if points[i].To <= points[i-1].To {
+			return nil, fmt.Errorf("Sync point targets must be increasing: %v -> %v", points[i].From, points[i].To)
+		}
+	}
+
+	first, last := points[0], points[len(points)-1]
+	f := func(t time.Duration) time.Duration {
+		switch {
+		case t < first.From || t > last.From:
+			p := first
+			if t > last.From {
+				p = last
+			}
+			switch {
+			case extrap == ExtrapolateNone:
+				return t
+			case extrap == ExtrapolateLinear && len(points) > 1:
+				if p == first {
+					return linearMap(first.From, points[1].From, first.To, points[1].To)(t)
+				}
+				p0 := points[len(points)-2]
+				return linearMap(p0.From, last.From, p0.To, last.To)(t)
+			}
+			return t + p.To - p.From
+		case len(points) == 1:
+			return t + first.To - first.From
+		}
+		// Segment containing t: first point having From >= t
+		i := sort.Search(len(points), func(i int) bool { return points[i].From >= t })
+		if i == 0 {
+			return first.To
+		}
+		return linearMap(points[i-1].From, points[i].From, points[i-1].To, points[i].To)(t)
+	}
+	return f, nil
+}
@@ -0,0 +1,169 @@
+/*
+
+This file implements SMPTE timecodes (e.g. 01:00:12:14) used by video editors.
+
+A timecode addresses a frame as HH:MM:SS:FF where FF is the frame within the second, counted at the
+nominal (integer) frame rate. At the NTSC rates (29.97 and 59.94 fps) the nominal rate (30 and 60)
+is faster than the real rate, so non-drop-frame (NDF) timecodes drift from the wall clock by 3.6
+seconds per hour. Drop-frame (DF) timecodes (written with a ';' before the frames, e.g. 01:00:12;14)
+compensate this by skipping frame numbers 0 and 1 (0-3 at 59.94 fps) at the start of every minute
+except every tenth minute. No frames are dropped, only frame numbers.
+
+Timecodes often start at a programme origin (e.g. 01:00:00:00), see SubsPack.Rebase().
+
+*/
+
+package srtgears
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Timecode is a SMPTE timecode.
+type Timecode struct {
+	Hours, Minutes, Seconds, Frames int
+
+	FrameRate float64 // Real frame rate, e.g. FrameRate2997
+	DropFrame bool    // Tells if this is a drop-frame timecode
+}
+
+// Regexp pattern used to parse timecodes, a ';' separator before the frames marks drop-frame.
+var timecodePattern = regexp.MustCompile(`^(\d\d?)[:;](\d\d)[:;](\d\d)([:;])(\d\d)$`)
+
+// IsTimecode tells if s looks like a SMPTE timecode (e.g. 01:00:12:14 or 01:00:12;14).
+func IsTimecode(s string) bool {
+	return timecodePattern.MatchString(s)
+}
+
+// nominalRate returns the nominal (integer) frame rate used for counting frames.
+func nominalRate(fps float64) int {
+	return int(math.Round(fps))
+}
+
+// dropFrames returns the number of frame numbers dropped per minute in drop-frame timecodes,
+// 0 if drop-frame is not applicable to the frame rate.
+func dropFrames(fps float64) int {
+	switch {
+	case math.Abs(fps-FrameRate2997) < 0.001:
+		return 2
+	case math.Abs(fps-FrameRate5994) < 0.001:
+		return 4
+	}
+	return 0
+}
+
+// ParseTimecode parses a SMPTE timecode in the form of HH:MM:SS:FF (non-drop-frame) or
+// HH:MM:SS;FF (drop-frame) at the given frame rate.
+func ParseTimecode(s string, fps float64) (*Timecode, error) {
+	parts := timecodePattern.FindStringSubmatch(s)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("Invalid timecode: %s", s)
+	}
+	tc := &Timecode{FrameRate: fps, DropFrame: parts[4] == ";"}
+	// Only digits are matched, so errors can be ignored
+	tc.Hours, _ = strconv.Atoi(parts[1])
+	tc.Minutes, _ = strconv.Atoi(parts[2])
+	tc.Seconds, _ = strconv.Atoi(parts[3])
+	tc.Frames, _ = strconv.Atoi(parts[5])
+	if err := tc.validate(); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// validate checks if the timecode addresses an existing frame.
+func (tc *Timecode) validate() error {
+	if tc.FrameRate <= 0 {
+		return fmt.Errorf("Frame rate must be positive: %v", tc.FrameRate)
+	}
+	drop := dropFrames(tc.FrameRate)
+	switch {
+	case tc.DropFrame && drop == 0:
+		return fmt.Errorf("Drop-frame timecode is only valid at 29.97 and 59.94 fps: %s", tc)
+	case tc.Minutes > 59 || tc.Seconds > 59 || tc.Frames >= nominalRate(tc.FrameRate):
+		return fmt.Errorf("Invalid timecode: %s", tc)
+	case tc.DropFrame && tc.Seconds == 0 && tc.Frames < drop && tc.Minutes%10 != 0:
+		return fmt.Errorf("Timecode is dropped in drop-frame: %s", tc)
+	}
+	return nil
+}
+
+// FrameNumber returns the number of frames since 00:00:00:00.
+func (tc *Timecode) FrameNumber() int64 {
+	nominal := int64(nominalRate(tc.FrameRate))
+	totalMinutes := int64(tc.Hours)*60 + int64(tc.Minutes)
+	n := (totalMinutes*60+int64(tc.Seconds))*nominal + int64(tc.Frames)
+	if tc.DropFrame {
+		n -= int64(dropFrames(tc.FrameRate)) * (totalMinutes - totalMinutes/10)
+	}
+	return n
+}
+
+// Duration returns the time of the frame addressed by the timecode.
+func (tc *Timecode) Duration() time.Duration {
+	return framesToDuration(tc.FrameNumber(), tc.FrameRate)
+}
+
+// String returns the timecode in the form of HH:MM:SS:FF (non-drop-frame) or HH:MM:SS;FF (drop-frame).
+func (tc *Timecode) String() string {
+	sep := ':'
+	if tc.DropFrame {
+		sep = ';'
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%c%02d", tc.Hours, tc.Minutes, tc.Seconds, sep, tc.Frames)
+}
+
+// TimecodeAt returns the timecode of the frame nearest to t at the given frame rate.
+// dropFrame is only applicable at 29.97 and 59.94 fps.
+func TimecodeAt(t time.Duration, fps float64, dropFrame bool) (*Timecode, error) {
+	if fps <= 0 {
+		return nil, fmt.Errorf("Frame rate must be positive: %v", fps)
+	}
+	drop := int64(dropFrames(fps))
+	if dropFrame && drop == 0 {
+		return nil, fmt.Errorf("Drop-frame timecode is only valid at 29.97 and 59.94 fps: %v", fps)
+	}
+
+	n, nominal := durationToFrames(t, fps), int64(nominalRate(fps))
+	if dropFrame {
+		// Add back the dropped frame numbers
+		perMinute := nominal*60 - drop
+		perTenMinutes := perMinute*10 + drop
+		tens, rem := n/perTenMinutes, n%perTenMinutes
+		n += drop * 9 * tens
+		if rem > drop {
+			n += drop * ((rem - drop) / perMinute)
+		}
+	}
+
+	return &Timecode{
+		Hours:     int(n / (nominal * 3600)),
+		Minutes:   int(n / (nominal * 60) % 60),
+		Seconds:   int(n / nominal % 60),
+		Frames:    int(n % nominal),
+		FrameRate: fps,
+		DropFrame: dropFrame,
+	}, nil
+}
+
+// Rebase rebases the subtitles from a timecode origin (e.g. a programme start of 01:00:00:00) to zero:
+// origin is subtracted from all timestamps. Subtitles ending before the origin are removed,
+// subtitles starting before it are cut to start at zero.
+func (sp *SubsPack) Rebase(origin time.Duration) {
+	subs := sp.Subs[:0]
+	for _, s := range sp.Subs {
+		if s.TimeOut <= origin {
+			continue
+		}
+		s.Shift(-origin)
+		if s.TimeIn < 0 {
+			s.TimeIn = 0
+		}
+		subs = append(subs, s)
+	}
+	sp.Subs = subs
+}
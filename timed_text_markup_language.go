@@ -0,0 +1,647 @@
+/*
+
+This file implements reading and writing the Timed Text Markup Language file format (*.ttml, *.dfxp).
+It can parse TTML files and create model from them.
+And it can also generate TTML content from a model, conforming to the IMSC1 Text profile.
+
+Format specifications:
+https://www.w3.org/TR/ttml1/
+https://www.w3.org/TR/ttml-imsc1.0.1/
+https://en.wikipedia.org/wiki/Timed_Text_Markup_Language
+
+The parser is permissive, it tries to parse the input even if it does not conform to the specification.
+Namespaces are not checked, so DFXP files (using the older TTAF namespaces) are also accepted.
+
+Time expressions are accepted in clock-time (e.g. "00:00:01.180" or "00:00:01:12" with frames),
+offset-time (e.g. "12.5s", "300f", "1200ms") and tick ("90000t") forms,
+the ttp:frameRate, ttp:frameRateMultiplier, ttp:subFrameRate and ttp:tickRate parameters are honoured.
+
+Regions (their tts:displayAlign) and tts:textAlign are mapped to and from our model Pos,
+tts:color to and from the subtitle color. <br/> separates lines, and styled spans are converted
+to and from <i>, <b>, <u> and <font color> markup.
+
+An example TTML file:
+
+	<?xml version="1.0" encoding="UTF-8"?>
+	<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" xml:lang="en">
+	  <head>
+	    <layout>
+	      <region xml:id="top" tts:origin="10% 10%" tts:extent="80% 80%" tts:displayAlign="before"/>
+	    </layout>
+	  </head>
+	  <body>
+	    <div>
+	      <p begin="00:02:17.440" end="00:02:20.375" region="top">Senator, we're making<br/>
+	        our final approach into <span tts:fontStyle="italic">Coruscant</span>.</p>
+	      <p begin="140.476s" dur="2025ms" tts:color="yellow">Very good, Lieutenant.</p>
+	    </div>
+	  </body>
+	</tt>
+
+*/
+
+package srtgears
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mapping between our model Pos to TTML region (vertical alignment) and tts:textAlign (horizontal alignment).
+var modelPosToTtml = map[Pos][2]string{
+	TopLeft: {"top", "left"}, Top: {"top", "center"}, TopRight: {"top", "right"},
+	Left: {"center", "left"}, Center: {"center", "center"}, Right: {"center", "right"},
+	BottomLeft: {"bottom", "left"}, Bottom: {"bottom", "center"}, BottomRight: {"bottom", "right"},
+}
+
+// Regions generated when writing, region names and their tts:displayAlign values.
+var ttmlRegions = [][2]string{{"top", "before"}, {"center", "center"}, {"bottom", "after"}}
+
+// ttmlNode is a simple DOM node of a TTML document.
+type ttmlNode struct {
+	Name     string            // Local name of the element
+	Attrs    map[string]string // Attributes by local name (namespaces are not checked)
+	Children []interface{}     // Child nodes, *ttmlNode or string (character data)
+}
+
+// child returns the first child element with the given name, or nil if there is no such child.
+func (n *ttmlNode) child(name string) *ttmlNode {
+	for _, c := range n.Children {
+		if cn, ok := c.(*ttmlNode); ok && cn.Name == name {
+			return cn
+		}
+	}
+	return nil
+}
+
+// ReadTtmlFile reads and parses a Timed Text Markup Language file (*.ttml, *.dfxp) and builds the model from it.
+func ReadTtmlFile(name string) (sp *SubsPack, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Reading from file: %s", name)
+	return ReadTtmlFrom(f)
+}
+
+// parseTtmlTree parses the XML document and returns its root element.
+func parseTtmlTree(r io.Reader) (root *ttmlNode, err error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	var stack []*ttmlNode
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &ttmlNode{Name: t.Name.Local, Attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				n.Attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, string(t))
+			}
+		}
+	}
+
+	if root == nil || root.Name != "tt" {
+		return nil, fmt.Errorf("Not a TTML document, missing <tt> root element")
+	}
+	return root, nil
+}
+
+// ttmlTiming holds the timing parameters of a TTML document.
+type ttmlTiming struct {
+	FrameRate    float64 // Effective frame rate (multiplier applied)
+	SubFrameRate float64 // Sub-frames per frame
+	TickRate     float64 // Ticks per second
+}
+
+// newTtmlTiming creates the timing parameters from the attributes of the <tt> element.
+func newTtmlTiming(attrs map[string]string) *ttmlTiming {
+	tt := &ttmlTiming{FrameRate: 30, SubFrameRate: 1}
+	frameRateSet := false
+	if v, err := strconv.ParseFloat(attrs["frameRate"], 64); err == nil && v > 0 {
+		tt.FrameRate, frameRateSet = v, true
+	}
+	if parts := strings.Fields(attrs["frameRateMultiplier"]); len(parts) == 2 {
+		num, err1 := strconv.ParseFloat(parts[0], 64)
+		den, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 == nil && err2 == nil && den > 0 {
+			tt.FrameRate = tt.FrameRate * num / den
+		}
+	}
+	if v, err := strconv.ParseFloat(attrs["subFrameRate"], 64); err == nil && v > 0 {
+		tt.SubFrameRate = v
+	}
+	tt.TickRate = 1
+	if frameRateSet {
+		tt.TickRate = tt.FrameRate * tt.SubFrameRate
+	}
+	if v, err := strconv.ParseFloat(attrs["tickRate"], 64); err == nil && v > 0 {
+		tt.TickRate = v
+	}
+	return tt
+}
+
+// Clock-time pattern, e.g. "00:00:01.180" or "00:00:01:12" or "00:00:01:12.1"
+var ttmlClockTimePattern = regexp.MustCompile(`^(\d{1,6}):(\d\d):(\d\d)(?:(\.\d{1,9})|:(\d{1,9})(?:\.(\d{1,9}))?)?$`)
+
+// Offset-time pattern, e.g. "12.5s", "300f", "90000t"
+var ttmlOffsetTimePattern = regexp.MustCompile(`^(\d{1,9}(?:\.\d{1,9})?)(h|ms|m|s|f|t)$`)
+
+// parse parses a TTML time expression.
+func (tt *ttmlTiming) parse(v string) (t time.Duration, ok bool) {
+	v = strings.TrimSpace(v)
+
+	if parts := ttmlClockTimePattern.FindStringSubmatch(v); len(parts) > 0 {
+		var err error
+		get := func(idx int) float64 {
+			if parts[idx] == "" || err != nil {
+				return 0
+			}
+			var f float64
+			f, err = strconv.ParseFloat(parts[idx], 64)
+			return f
+		}
+		secs := get(1)*3600 + get(2)*60 + get(3) + get(4)
+		secs += (get(5) + get(6)/tt.SubFrameRate) / tt.FrameRate // Frames and sub-frames
+		if err != nil {
+			return
+		}
+		return ttmlSecs(secs)
+	}
+
+	if parts := ttmlOffsetTimePattern.FindStringSubmatch(v); len(parts) > 0 {
+		f, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return
+		}
+		switch parts[2] {
+		case "h":
+			f *= 3600
+		case "m":
+			f *= 60
+		case "ms":
+			f /= 1000
+		case "f":
+			f /= tt.FrameRate
+		case "t":
+			f /= tt.TickRate
+		}
+		return ttmlSecs(f)
+	}
+
+	return
+}
+
+// ttmlSecs converts seconds to time.Duration, rounded to milliseconds.
+// Returns false if secs is not representable by time.Duration.
+func ttmlSecs(secs float64) (time.Duration, bool) {
+	if math.IsNaN(secs) || secs < 0 || math.Round(secs*1000) >= math.MaxInt64/float64(time.Millisecond) {
+		return 0, false
+	}
+	return time.Duration(math.Round(secs*1000)) * time.Millisecond, true
+}
+
+// ttmlStyle is the computed style of an element, attributes by local names.
+type ttmlStyle map[string]string
+
+// with returns a new style, which is this style overridden by the given attributes.
+func (st ttmlStyle) with(attrs map[string]string) ttmlStyle {
+	st2 := make(ttmlStyle, len(st)+len(attrs))
+	for k, v := range st {
+		st2[k] = v
+	}
+	for k, v := range attrs {
+		st2[k] = v
+	}
+	return st2
+}
+
+// ttmlReader holds the state of parsing a TTML document.
+type ttmlReader struct {
+	timing  *ttmlTiming
+	styles  map[string]*ttmlNode // Style definitions by id
+	regions map[string]*ttmlNode // Region definitions by id
+	sp      *SubsPack
+}
+
+// styleAttrs returns the styling attributes of an element, including the ones of the referenced styles.
+func (tr *ttmlReader) styleAttrs(n *ttmlNode, depth int) ttmlStyle {
+	st := ttmlStyle{}
+	if depth > 10 {
+		return st // Protection against circular references
+	}
+	for _, id := range strings.Fields(n.Attrs["style"]) {
+		if sn := tr.styles[id]; sn != nil {
+			st = st.with(tr.styleAttrs(sn, depth+1))
+		}
+	}
+	attrs := ttmlStyle{}
+	for k, v := range n.Attrs {
+		switch k {
+		case "id", "style", "begin", "end", "dur", "region", "lang", "space":
+		default:
+			attrs[k] = v
+		}
+	}
+	return st.with(attrs)
+}
+
+// ReadTtmlFrom reads and parses a Timed Text Markup Language from an io.Reader (*.ttml, *.dfxp) and builds the model from it.
+func ReadTtmlFrom(r io.Reader) (sp *SubsPack, err error) {
+	root, err := parseTtmlTree(r)
+	if err != nil {
+		return
+	}
+
+	tr := &ttmlReader{
+		timing:  newTtmlTiming(root.Attrs),
+		styles:  map[string]*ttmlNode{},
+		regions: map[string]*ttmlNode{},
+		sp:      &SubsPack{},
+	}
+
+	if head := root.child("head"); head != nil {
+		for _, section := range []string{"styling", "layout"} {
+			sn := head.child(section)
+			if sn == nil {
+				continue
+			}
+			for _, c := range sn.Children {
+				if cn, ok := c.(*ttmlNode); ok && cn.Attrs["id"] != "" {
+					switch cn.Name {
+					case "style":
+						tr.styles[cn.Attrs["id"]] = cn
+					case "region":
+						tr.regions[cn.Attrs["id"]] = cn
+					}
+				}
+			}
+		}
+	}
+
+	if body := root.child("body"); body != nil {
+		tr.procTimed(body, 0, ttmlStyle{}, "")
+	}
+
+	debugf("Loaded %d subtitles.", len(tr.sp.Subs))
+
+	sp = tr.sp
+	sp.Sort()
+	return
+}
+
+// procTimed processes a timed container element (<body> or <div>) or a paragraph (<p>).
+// parentBegin is the begin time of the parent, style is the inherited style, region is the inherited region id.
+func (tr *ttmlReader) procTimed(n *ttmlNode, parentBegin time.Duration, style ttmlStyle, region string) {
+	begin := parentBegin
+	if v, ok := n.Attrs["begin"]; ok {
+		if t, ok := tr.timing.parse(v); ok {
+			begin += t
+		} else {
+			debugf("Invalid begin time: %s", v)
+		}
+	}
+	style = style.with(tr.styleAttrs(n, 0))
+	if v := n.Attrs["region"]; v != "" {
+		region = v
+	}
+
+	if n.Name == "p" {
+		tr.procP(n, parentBegin, begin, style, region)
+		return
+	}
+
+	for _, c := range n.Children {
+		if cn, ok := c.(*ttmlNode); ok && (cn.Name == "div" || cn.Name == "p") {
+			tr.procTimed(cn, begin, style, region)
+		}
+	}
+}
+
+// procP processes a paragraph, creating a subtitle from it.
+// Its end time is relative to parentBegin, its begin time is already resolved.
+func (tr *ttmlReader) procP(n *ttmlNode, parentBegin, begin time.Duration, style ttmlStyle, region string) {
+	s := &Subtitle{TimeIn: begin, TimeOut: begin}
+
+	if v, ok := n.Attrs["end"]; ok {
+		if t, ok := tr.timing.parse(v); ok {
+			s.TimeOut = parentBegin + t
+		} else {
+			debugf("Invalid end time: %s", v)
+		}
+	} else if v, ok := n.Attrs["dur"]; ok {
+		if t, ok := tr.timing.parse(v); ok {
+			s.TimeOut = s.TimeIn + t
+		} else {
+			debugf("Invalid dur time: %s", v)
+		}
+	}
+	if s.TimeOut <= s.TimeIn {
+		debugf("Begin >= End, text won't be visible: begin=%s", n.Attrs["begin"])
+	}
+
+	// Position
+	row, col := 0, 1 // Default is bottom center
+	specified := false
+	switch style["textAlign"] {
+	case "left", "start":
+		col, specified = 0, true
+	case "right", "end":
+		col, specified = 2, true
+	}
+	if rn := tr.regions[region]; rn != nil {
+		rstyle := tr.styleAttrs(rn, 0)
+		switch rstyle["displayAlign"] {
+		case "before":
+			row, specified = 2, true
+		case "center":
+			row, specified = 1, true
+		case "after":
+			specified = true
+		default:
+			// Try to tell it from the vertical origin
+			if origin := strings.Fields(rstyle["origin"]); len(origin) == 2 && strings.HasSuffix(origin[1], "%") {
+				if y, err := strconv.ParseFloat(strings.TrimSuffix(origin[1], "%"), 64); err == nil && y < 100.0/3 {
+					row, specified = 2, true
+				}
+			}
+		}
+	}
+	if specified && posGrid[row][col] != Bottom { // Bottom is the default position
+		s.Pos = posGrid[row][col]
+	}
+
+	s.Color = ttmlColor(style["color"])
+
+	// Texts. The paragraph itself may be italic, bold or underlined, so compare to a plain style.
+	plain := style.with(map[string]string{"fontStyle": "normal", "fontWeight": "normal", "textDecoration": "none"})
+	var b strings.Builder
+	tr.procSpan(n, style, plain, s.Color, &b)
+	for _, line := range strings.Split(b.String(), "\n") {
+		line = strings.TrimSpace(ttmlWhitespacePattern.ReplaceAllString(line, " "))
+		s.Lines = append(s.Lines, line)
+	}
+
+	tr.sp.Subs = append(tr.sp.Subs, s)
+}
+
+// Pattern of whitespace runs, TTML collapses them.
+var ttmlWhitespacePattern = regexp.MustCompile(`\s+`)
+
+// procSpan generates the text of an element having the given style, converting <br/> to newline and
+// styling different from the parent style to <i>, <b>, <u> and <font color> markup.
+// color is the color of the subtitle, spans only get <font> if their color differs.
+func (tr *ttmlReader) procSpan(n *ttmlNode, style, parent ttmlStyle, color string, b *strings.Builder) {
+	var closing []string
+	if spanColor := ttmlColor(style["color"]); spanColor != ttmlColor(parent["color"]) && spanColor != color {
+		fmt.Fprintf(b, `<font color="%s">`, spanColor)
+		closing = append(closing, "</font>")
+	}
+	if style["fontStyle"] == "italic" && parent["fontStyle"] != "italic" {
+		b.WriteString("<i>")
+		closing = append(closing, "</i>")
+	}
+	if style["fontWeight"] == "bold" && parent["fontWeight"] != "bold" {
+		b.WriteString("<b>")
+		closing = append(closing, "</b>")
+	}
+	if strings.Contains(style["textDecoration"], "underline") && !strings.Contains(parent["textDecoration"], "underline") {
+		b.WriteString("<u>")
+		closing = append(closing, "</u>")
+	}
+
+	for _, c := range n.Children {
+		switch cn := c.(type) {
+		case string:
+			b.WriteString(strings.Replace(cn, "\n", " ", -1))
+		case *ttmlNode:
+			switch cn.Name {
+			case "br":
+				b.WriteString("\n")
+			case "metadata":
+				// Not displayed
+			default: // span, or unknown element whose content is still displayed
+				tr.procSpan(cn, style.with(tr.styleAttrs(cn, 0)), style, color, b)
+			}
+		}
+	}
+
+	for i := len(closing) - 1; i >= 0; i-- {
+		b.WriteString(closing[i])
+	}
+}
+
+// Pattern of the rgb() and rgba() color expressions.
+var ttmlRGBPattern = regexp.MustCompile(`^rgba?\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*(?:,\s*\d+\s*)?\)$`)
+
+// ttmlColor converts a TTML color expression to our model color.
+// White is the default color, so it is converted to empty string.
+func ttmlColor(v string) string {
+	v = strings.TrimSpace(v)
+	if parts := ttmlRGBPattern.FindStringSubmatch(v); len(parts) > 0 {
+		rgb := [3]int{}
+		for i := range rgb {
+			rgb[i], _ = strconv.Atoi(parts[i+1])
+		}
+		v = fmt.Sprintf("#%02x%02x%02x", rgb[0]&0xff, rgb[1]&0xff, rgb[2]&0xff)
+	}
+	if strings.HasPrefix(v, "#") && len(v) == 9 {
+		v = v[:7] // Cut off alpha
+	}
+	switch strings.ToLower(v) {
+	case "white", "#ffffff":
+		return ""
+	}
+	return v
+}
+
+// WriteTtmlFile generates Timed Text Markup Language format (*.ttml) and writes it to a file.
+func WriteTtmlFile(name string, sp *SubsPack) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Writing %d subtitles to file: %s", len(sp.Subs), name)
+	return WriteTtmlTo(f, sp)
+}
+
+// ttmlEscape escapes a string to be used in XML text or attribute values.
+func ttmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// ttmlText converts the lines of a subtitle to TTML content,
+// HTML formatting is converted to spans, controls are removed.
+func ttmlText(lines []string) string {
+	var b strings.Builder
+	open := 0 // Number of open spans
+
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("<br/>")
+		}
+		line = anyControlPattern.ReplaceAllString(line, "")
+		pos := 0
+		for _, loc := range htmlPattern.FindAllStringIndex(line, -1) {
+			b.WriteString(ttmlEscape(line[pos:loc[0]]))
+			pos = loc[1]
+
+			parts := formatTagPattern.FindStringSubmatch(line[loc[0]:loc[1]])
+			if len(parts) == 0 {
+				continue // Unsupported tag, drop it
+			}
+			if parts[1] == "/" {
+				if open > 0 { // Drop stray closing tags
+					b.WriteString("</span>")
+					open--
+				}
+				continue
+			}
+			switch strings.ToLower(parts[2]) {
+			case "i":
+				b.WriteString(`<span tts:fontStyle="italic">`)
+			case "b":
+				b.WriteString(`<span tts:fontWeight="bold">`)
+			case "u":
+				b.WriteString(`<span tts:textDecoration="underline">`)
+			case "font":
+				if m := fontColorPattern.FindStringSubmatch(parts[3]); len(m) > 0 {
+					fmt.Fprintf(&b, `<span tts:color="%s">`, ttmlEscape(m[1]))
+				} else {
+					b.WriteString(`<span>`)
+				}
+			}
+			open++
+		}
+		b.WriteString(ttmlEscape(line[pos:]))
+	}
+
+	// Close unclosed tags
+	for ; open > 0; open-- {
+		b.WriteString("</span>")
+	}
+
+	return b.String()
+}
+
+// WriteTtmlTo generates Timed Text Markup Language format (*.ttml) and writes it to an io.Writer.
+func WriteTtmlTo(w io.Writer, sp *SubsPack) error {
+	wr := &writer{w: w}
+
+	// No BOM, the XML declaration tells the encoding
+	wr.prn(`<?xml version="1.0" encoding="UTF-8"?>`)
+	wr.prn(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter"`,
+		` xmlns:tts="http://www.w3.org/ns/ttml#styling" xmlns:ttm="http://www.w3.org/ns/ttml#metadata"`,
+		` ttp:profile="http://www.w3.org/ns/ttml/profile/imsc1/text" xml:lang="">`)
+	wr.prn(`  <head>`)
+	wr.prn(`    <metadata>`)
+	wr.prn(`      <ttm:title></ttm:title>`)
+	wr.prn(`      <ttm:desc>Generated by Srtgears, `, HomePage, `</ttm:desc>`)
+	wr.prn(`    </metadata>`)
+
+	// Styles: unique (textAlign, color) pairs
+	type ttmlStyleKey struct{ textAlign, color string }
+	subStyles := make([]string, len(sp.Subs)) // Style ids of subtitles
+	stylesMap := map[ttmlStyleKey]string{}    // Unique style keys
+	styles := []ttmlStyleKey{}                // Maintain order of unique style keys for generation
+	for i, s := range sp.Subs {
+		pos := s.Pos
+		if pos == PosNotSpecified {
+			pos = Bottom // Assign default position
+		}
+		k := ttmlStyleKey{textAlign: modelPosToTtml[pos][1], color: s.Color}
+		if _, ok := stylesMap[k]; !ok {
+			styles = append(styles, k)
+			stylesMap[k] = "s" + strconv.Itoa(len(styles))
+		}
+		subStyles[i] = stylesMap[k]
+	}
+	wr.prn(`    <styling>`)
+	for _, k := range styles {
+		wr.prf(`      <style xml:id="%s" tts:textAlign="%s"`, stylesMap[k], k.textAlign)
+		if k.color != "" {
+			wr.prf(` tts:color="%s"`, ttmlEscape(k.color))
+		}
+		wr.prn(`/>`)
+	}
+	wr.prn(`    </styling>`)
+
+	wr.prn(`    <layout>`)
+	for _, r := range ttmlRegions {
+		wr.prf(`      <region xml:id="%s" tts:origin="10%% 10%%" tts:extent="80%% 80%%" tts:displayAlign="%s"/>`, r[0], r[1])
+		wr.prn()
+	}
+	wr.prn(`    </layout>`)
+	wr.prn(`  </head>`)
+	wr.prn(`  <body>`)
+	wr.prn(`    <div>`)
+
+	printTime := func(t time.Duration) {
+		hour := t / time.Hour
+		min := (t % time.Hour) / time.Minute
+		sec := (t % time.Minute) / time.Second
+		ms := (t % time.Second) / time.Millisecond
+		wr.prf("%02d:%02d:%02d.%03d", hour, min, sec, ms)
+	}
+
+	for i, s := range sp.Subs {
+		if wr.err != nil {
+			break
+		}
+
+		pos := s.Pos
+		if pos == PosNotSpecified {
+			pos = Bottom // Assign default position
+		}
+
+		wr.pr(`      <p begin="`)
+		printTime(s.TimeIn)
+		wr.pr(`" end="`)
+		printTime(s.TimeOut)
+		wr.prf(`" region="%s" style="%s">`, modelPosToTtml[pos][0], subStyles[i])
+		wr.pr(ttmlText(s.Lines))
+		wr.prn(`</p>`)
+	}
+
+	wr.prn(`    </div>`)
+	wr.prn(`  </body>`)
+	wr.prn(`</tt>`)
+
+	return wr.err
+}
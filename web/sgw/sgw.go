@@ -13,13 +13,14 @@ package sgw
 import (
 	"appengine"
 	"archive/zip"
+	"bytes"
 	"fmt"
 	"github.com/icza/srtgears"
 	"github.com/icza/srtgears/exec"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"path"
-	"strings"
 	"time"
 )
 
@@ -51,6 +52,24 @@ func sgwHandler(w http.ResponseWriter, r *http.Request) {
 		args = append(args, "-in2", inh2.Filename)
 	}
 
+	syncTo, sth, err := r.FormFile("syncTo")
+	if err == nil {
+		c.Debugf("Received uploaded file 'syncTo': %s", sth.Filename)
+		args = append(args, "-syncTo", sth.Filename)
+	}
+
+	syncPoints, sph, err := r.FormFile("syncPoints")
+	if err == nil {
+		c.Debugf("Received uploaded file 'syncPoints': %s", sph.Filename)
+		args = append(args, "-syncPoints", sph.Filename)
+	}
+
+	replace, rph, err := r.FormFile("replace")
+	if err == nil {
+		c.Debugf("Received uploaded file 'replace': %s", rph.Filename)
+		args = append(args, "-replace", rph.Filename)
+	}
+
 	args = rewindForm(args, r)
 
 	// Our heart: the Executor
@@ -63,7 +82,7 @@ func sgwHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Read input files
 	if in != nil {
-		if e.Sp1, err = srtgears.ReadSrtFrom(in); err != nil {
+		if e.Sp1, err = readSubs(in, inh.Filename, e); err != nil {
 			c.Errorf("Failed to parse uploaded file 'in': %v", err)
 			fmt.Fprint(w, "Failed to parse uploaded file: ", err)
 			return
@@ -71,66 +90,119 @@ func sgwHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if in2 != nil {
-		if e.Sp2, err = srtgears.ReadSrtFrom(in2); err != nil {
+		if e.Sp2, err = readSubs(in2, inh2.Filename, e); err != nil {
 			c.Errorf("Failed to parse uploaded file 'in2': %v", err)
 			fmt.Fprint(w, "Failed to parse 2nd uploaded file: ", err)
 			return
 		}
 	}
 
-	// We want stats in plain text...
-	e.BeforeStats = func() {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if syncTo != nil {
+		if e.SpRef, err = readSubs(syncTo, sth.Filename, e); err != nil {
+			c.Errorf("Failed to parse uploaded file 'syncTo': %v", err)
+			fmt.Fprint(w, "Failed to parse uploaded reference file: ", err)
+			return
+		}
+	}
+
+	if syncPoints != nil {
+		if e.SyncPointsData, err = ioutil.ReadAll(syncPoints); err != nil {
+			c.Errorf("Failed to read uploaded file 'syncPoints': %v", err)
+			fmt.Fprint(w, "Failed to read uploaded sync points file: ", err)
+			return
+		}
+	}
+
+	if replace != nil {
+		if e.ReplaceData, err = ioutil.ReadAll(replace); err != nil {
+			c.Errorf("Failed to read uploaded file 'replace': %v", err)
+			fmt.Fprint(w, "Failed to read uploaded replace rules file: ", err)
+			return
+		}
+	}
+
+	// If subtitles are to be sent, the report (lint, replacement counts) can't precede them in the response,
+	// it is sent in the zip.
+	sendingSubs := !e.Stats && !(e.Lint && e.Out == "")
+	var report bytes.Buffer
+	if sendingSubs {
+		e.SetOutput(&report)
+	} else {
+		// We want stats in plain text...
+		e.BeforeStats = func() {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
 	}
 	// Perform transformations
 	if err := e.GearIt(); err != nil {
+		w.Write(report.Bytes()) // E.g. the lint report of the found errors
 		fmt.Fprint(w, err)
 		return
 	}
 
-	if e.Stats {
-		return // If stats was specified, response is already committed.
+	if !sendingSubs {
+		return // If stats or lint (without output) was specified, response is already committed.
 	}
 
 	// Everything went ok. We can now generate and send the transformed subtitles.
-	if err := sendSubs(w, e); err != nil {
+	if err := sendSubs(w, e, report.Bytes()); err != nil {
 		c.Errorf("Failed to send subtitles: %v", err)
 	}
 }
 
-// sendSubs generates and send the transformed subtitles, zipped.
-func sendSubs(w http.ResponseWriter, e *exec.Executor) (err error) {
+// readSubs parses an uploaded subtitle file, the format is chosen by the file name extension or by the content.
+// The character encoding is detected unless specified.
+func readSubs(r io.Reader, name string, e *exec.Executor) (*srtgears.SubsPack, error) {
+	inEnc, _, err := e.Encodings()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, _ = srtgears.ToUTF8(data, inEnc)
+	f := srtgears.DetectFormat(name, data)
+	if f == nil {
+		return nil, fmt.Errorf("Unsupported input format, only %s are supported: %s", exec.ExtList(), name)
+	}
+	return e.ConfigFormat(f, false).Read(bytes.NewReader(data))
+}
+
+// sendSubs generates and send the transformed subtitles, zipped. The report of the executor (if any) is added as report.txt.
+func sendSubs(w http.ResponseWriter, e *exec.Executor, report []byte) (err error) {
 	// First checks extensions so we can send back error.
 	// Once we start writing zip, there's no going back.
 	validExt := func(name string) bool {
-		switch ext := strings.ToLower(path.Ext(name)); ext {
-		case ".srt", ".ssa":
-			return true
-		case "":
+		ext := path.Ext(name)
+		switch {
+		case ext == "":
 			fmt.Fprintf(w, "Output extension not specified: %s", name)
+		case srtgears.FormatByExt(ext) == nil:
+			fmt.Fprintf(w, "Unsupported file extension, only %s are supported: %s", exec.ExtList(), ext)
 		default:
-			fmt.Fprintf(w, "Unsupported file extension, only *.srt and *.ssa are supported: %s", ext)
+			return true
 		}
 		return false
 	}
 
-	fileCount := 0
-	if e.Out != "" && e.Sp1 != nil {
-		if !validExt(e.Out) {
+	outputs := e.Outputs()
+	names := map[string]bool{}
+	for _, o := range outputs {
+		if !validExt(o.Name) {
 			return
 		}
-		fileCount++
-	}
-	if e.Out2 != "" && e.Sp2 != nil {
-		if !validExt(e.Out2) {
+		if names[o.Name] {
+			fmt.Fprint(w, "The output file names must be different ('-out' and '-out2')!")
 			return
 		}
-		fileCount++
+		names[o.Name] = true
 	}
 
-	if fileCount == 2 && e.Out == e.Out2 {
-		fmt.Fprint(w, "The 2 output file names must be different ('-out' and '-out2')!")
-		return
+	_, outEnc, err := e.Encodings()
+	if err != nil {
+		fmt.Fprint(w, err)
+		return nil
 	}
 
 	w.Header().Set("Content-Type", "application/zip")
@@ -146,24 +218,23 @@ func sendSubs(w http.ResponseWriter, e *exec.Executor) (err error) {
 		if f, err = zw.CreateHeader(fh); err != nil {
 			return
 		}
-		switch ext := strings.ToLower(path.Ext(name)); ext {
-		case ".srt":
-			return srtgears.WriteSrtTo(f, sp)
-		case ".ssa":
-			return srtgears.WriteSsaTo(f, sp)
-		}
-		return
+		return e.ConfigFormat(srtgears.FormatByExt(path.Ext(name)), true).Write(outEnc.NewWriter(f), sp)
 	}
 
-	if e.Out != "" && e.Sp1 != nil {
-		if err = wf(e.Out, e.Sp1); err != nil {
+	for _, o := range outputs {
+		if err = wf(o.Name, o.Sp); err != nil {
 			return
 		}
 	}
-	if e.Out2 != "" && e.Sp2 != nil {
-		if err = wf(e.Out2, e.Sp2); err != nil {
+
+	if len(report) > 0 {
+		var f io.Writer
+		fh := &zip.FileHeader{Name: "report.txt", Method: zip.Deflate}
+		fh.SetModTime(time.Now())
+		if f, err = zw.CreateHeader(fh); err != nil {
 			return
 		}
+		_, err = f.Write(report)
 	}
 
 	return
@@ -187,15 +258,57 @@ func rewindForm(args []string, r *http.Request) []string {
 	if s := r.FormValue("lengthen"); s != "" {
 		args = append(args, "-lengthen="+s)
 	}
+	if s := r.FormValue("overlaps"); s != "" {
+		args = append(args, "-overlaps="+s)
+	}
+	if s := r.FormValue("cps"); s != "" {
+		args = append(args, "-cps="+s)
+	}
+	if s := r.FormValue("wpm"); s != "" {
+		args = append(args, "-wpm="+s)
+	}
+	if s := r.FormValue("minDur"); s != "" {
+		args = append(args, "-minDur="+s)
+	}
+	if s := r.FormValue("maxDur"); s != "" {
+		args = append(args, "-maxDur="+s)
+	}
+	if s := r.FormValue("minGap"); s != "" {
+		args = append(args, "-minGap="+s)
+	}
 	if s := r.FormValue("removectrl"); s != "" {
 		args = append(args, "-removectrl")
 	}
 	if s := r.FormValue("removehi"); s != "" {
 		args = append(args, "-removehi")
 	}
+	if s := r.FormValue("hiModes"); s != "" {
+		args = append(args, "-hiModes="+s)
+	}
 	if s := r.FormValue("removehtml"); s != "" {
 		args = append(args, "-removehtml")
 	}
+	if s := r.FormValue("keepTags"); s != "" {
+		args = append(args, "-keepTags")
+	}
+	if s := r.FormValue("maxLineLen"); s != "" {
+		args = append(args, "-maxLineLen="+s)
+	}
+	if s := r.FormValue("maxLines"); s != "" {
+		args = append(args, "-maxLines="+s)
+	}
+	if s := r.FormValue("reflow"); s != "" {
+		args = append(args, "-reflow="+s)
+	}
+	if s := r.FormValue("mergeShort"); s != "" {
+		args = append(args, "-mergeShort="+s)
+	}
+	if s := r.FormValue("dialogue"); s != "" {
+		args = append(args, "-dialogue")
+	}
+	if s := r.FormValue("splitLong"); s != "" {
+		args = append(args, "-splitLong")
+	}
 	if s := r.FormValue("pos"); s != "" {
 		args = append(args, "-pos="+s)
 	}
@@ -205,15 +318,57 @@ func rewindForm(args []string, r *http.Request) []string {
 	if s := r.FormValue("scale"); s != "" {
 		args = append(args, "-scale="+s)
 	}
+	if s := r.FormValue("cut"); s != "" {
+		args = append(args, "-cut="+s)
+	}
+	if s := r.FormValue("insertGap"); s != "" {
+		args = append(args, "-insertGap="+s)
+	}
+	if s := r.FormValue("extract"); s != "" {
+		args = append(args, "-extract="+s)
+	}
 	if s := r.FormValue("shiftBy"); s != "" {
 		args = append(args, "-shiftBy="+s)
 	}
+	if s := r.FormValue("sync"); s != "" {
+		args = append(args, "-sync="+s)
+	}
+	if s := r.FormValue("syncExtrap"); s != "" {
+		args = append(args, "-syncExtrap="+s)
+	}
 	if s := r.FormValue("splitAt"); s != "" {
 		args = append(args, "-splitAt="+s)
 	}
+	if s := r.FormValue("splitClip"); s != "" {
+		args = append(args, "-splitClip")
+	}
 	if s := r.FormValue("stats"); s != "" {
 		args = append(args, "-stats")
 	}
+	if s := r.FormValue("fps"); s != "" {
+		args = append(args, "-fps="+s)
+	}
+	if s := r.FormValue("lint"); s != "" {
+		args = append(args, "-lint")
+	}
+	if s := r.FormValue("lintRules"); s != "" {
+		args = append(args, "-lintRules="+s)
+	}
+	if s := r.FormValue("fpsSnap"); s != "" {
+		args = append(args, "-fpsSnap")
+	}
+	if s := r.FormValue("tcFps"); s != "" {
+		args = append(args, "-tcFps="+s)
+	}
+	if s := r.FormValue("tcOrigin"); s != "" {
+		args = append(args, "-tcOrigin="+s)
+	}
+	if s := r.FormValue("inEnc"); s != "" {
+		args = append(args, "-inEnc="+s)
+	}
+	if s := r.FormValue("outEnc"); s != "" {
+		args = append(args, "-outEnc="+s)
+	}
 
 	return args
 }
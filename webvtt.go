@@ -0,0 +1,504 @@
+/*
+
+This file implements reading and writing the Web Video Text Tracks file format (*.vtt).
+It can parse *.vtt files and create model from them.
+And it can also generate WebVTT content from a model.
+
+Format specifications:
+https://www.w3.org/TR/webvtt1/
+https://en.wikipedia.org/wiki/WebVTT
+
+The parser is permissive, it tries to parse the input even if it does not conform to the specification.
+
+Cue identifiers are skipped, sequence numbers are generated when writing.
+Cue settings are mapped to and from our model Pos, a <c.color> span wrapping the whole cue text
+to and from the subtitle color. Other markup (such as <v Speaker> voice spans) is kept as-is.
+Character references (e.g. &amp;) are unescaped when reading, and text is escaped when writing.
+When writing, <font color=""> tags (e.g. of SubRip) are converted to <c.color> spans, other tags not supported
+by WebVTT are removed, and empty lines are skipped (they would end the cue).
+NOTE, STYLE and REGION blocks are preserved in SubsPack.VttBlocks.
+
+An example WebVTT file:
+
+	WEBVTT
+
+	NOTE This is a comment.
+
+	1
+	00:02:17.440 --> 00:02:20.375 line:0
+	<v Palpatine>Senator, we're making
+	our final approach into Coruscant.
+
+	2
+	02:20.476 --> 02:22.501
+	<c.yellow>Very good, Lieutenant.</c>
+
+*/
+
+package srtgears
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cue settings of our model Pos.
+var modelPosToVttSettings = map[Pos]string{
+	TopLeft: "line:0 align:left", Top: "line:0", TopRight: "line:0 align:right",
+	Left: "line:50%,center align:left", Center: "line:50%,center", Right: "line:50%,center align:right",
+	BottomLeft: "align:left", Bottom: "", BottomRight: "align:right",
+}
+
+// Color classes that are defined by WebVTT, no STYLE is needed for them.
+var vttDefaultColorClasses = map[string]bool{
+	"white": true, "lime": true, "cyan": true, "red": true,
+	"yellow": true, "magenta": true, "blue": true, "black": true,
+}
+
+// Marker of the STYLE blocks generated by us. They are not preserved when reading,
+// as they are generated again when writing.
+const vttGeneratedMarker = "/* Generated by Srtgears */"
+
+// ReadVttFile reads and parses a WebVTT file (*.vtt) and builds the model from it.
+func ReadVttFile(name string) (sp *SubsPack, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Reading from file: %s", name)
+	return ReadVttFrom(f)
+}
+
+// Regexp pattern to extract data from cue timing lines, hours are optional:
+//
+//	00:02:20.476 --> 02:22.501 line:0 align:left
+//
+// Number of digits of hours is limited so they can't overflow.
+var vttTimingPattern = regexp.MustCompile(`^\s*(?:(\d{1,6}):)?(\d\d):(\d\d)\.(\d\d\d)\s+-->\s+(?:(\d{1,6}):)?(\d\d):(\d\d)\.(\d\d\d)(.*)`)
+
+// Starter <c> span with the class names (e.g. "<c.yellow.bg_black>").
+var vttStarterClassPattern = regexp.MustCompile(`^<c((?:\.[^.\s>]+)+)>`)
+
+// </c> closing tag pattern at the end of a line.
+var vttClassClosingPattern = regexp.MustCompile(`</c>\s*$`)
+
+// Class name pattern of colors that do not have a name.
+var vttRGBClassPattern = regexp.MustCompile(`^rgb([0-9a-f]{6})$`)
+
+// ReadVttFrom reads and parses a WebVTT from an io.Reader (*.vtt) and builds the model from it.
+func ReadVttFrom(r io.Reader) (sp *SubsPack, err error) {
+	sp = &SubsPack{}
+	scanner := bufio.NewScanner(r)
+
+	var block []string // Lines of the current block
+	blockLineNum := 0  // Line number of the first line of the current block
+
+	procBlock := func() {
+		defer func() { block = nil }()
+		if len(block) == 0 {
+			return
+		}
+		switch first := block[0]; {
+		case strings.HasPrefix(first, "WEBVTT"):
+			// Header block, nothing to do
+		case first == "NOTE" || strings.HasPrefix(first, "NOTE ") || strings.HasPrefix(first, "NOTE\t"),
+			first == "STYLE", first == "REGION":
+			text := strings.Join(block, "\n")
+			if first == "STYLE" && strings.Contains(text, vttGeneratedMarker) {
+				break
+			}
+			sp.VttBlocks = append(sp.VttBlocks, text)
+		default:
+			if !strings.Contains(first, "-->") {
+				// First line is a cue identifier, discard it, we generate sequence numbers when writing
+				block = block[1:]
+				blockLineNum++
+				if len(block) == 0 {
+					debugf("Missing cue timing in line %d", blockLineNum)
+					return
+				}
+			}
+			if s := parseVttCue(block, blockLineNum); s != nil {
+				sp.Subs = append(sp.Subs, s)
+			}
+		}
+	}
+
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if lineNum == 0 {
+			// If BOM is present, strip it off. It's "\uFEFF", which is "\xef\xbb\xbf" in UTF-8
+			if strings.HasPrefix(line, "\xef\xbb\xbf") {
+				line = line[3:]
+			}
+			if !strings.HasPrefix(line, "WEBVTT") {
+				debugf("Missing WEBVTT header in line 1: %s", line)
+			}
+		}
+		lineNum++
+		if strings.TrimSpace(line) == "" {
+			procBlock() // End of block, separator
+			continue
+		}
+		if len(block) == 0 {
+			blockLineNum = lineNum
+		}
+		block = append(block, line)
+	}
+	procBlock() // Process last block if there is no empty line at the end of input
+
+	debugf("Loaded %d subtitles.", len(sp.Subs))
+
+	sp.Sort()
+
+	err = scanner.Err()
+	return
+}
+
+// parseVttCue parses a cue block whose first line is the cue timing line.
+// Returns nil if the cue timing line is invalid.
+func parseVttCue(block []string, lineNum int) *Subtitle {
+	// Example: 00:02:20.476 --> 02:22.501 line:0
+	parts := vttTimingPattern.FindStringSubmatch(block[0])
+	if len(parts) == 0 {
+		// No match, invalid timing line
+		debugf("Invalid cue timing in line %d: %s", lineNum, block[0])
+		return nil
+	}
+
+	get := func(idx int) time.Duration {
+		if parts[idx] == "" {
+			return 0 // Optional hours
+		}
+		n, err := strconv.ParseInt(parts[idx], 10, 64)
+		if err != nil {
+			panic(err) // This shouldn't happen as only a limited number of digits are matched.
+		}
+		return time.Duration(n)
+	}
+
+	// First part is the complete match
+	s := &Subtitle{
+		TimeIn:  time.Hour*get(1) + time.Minute*get(2) + time.Second*get(3) + time.Millisecond*get(4),
+		TimeOut: time.Hour*get(5) + time.Minute*get(6) + time.Second*get(7) + time.Millisecond*get(8),
+		Pos:     parseVttSettings(parts[9]),
+		Lines:   append([]string(nil), block[1:]...),
+	}
+
+	if s.TimeOut <= s.TimeIn {
+		debugf("Time1 >= Time2, text won't be visible in line %d: %s", lineNum, block[0])
+	}
+
+	// Find if there is a color class <c> span wrapping all lines
+	if len(s.Lines) > 0 {
+		first, last := 0, len(s.Lines)-1
+		starter := vttStarterClassPattern.FindStringSubmatch(s.Lines[first])
+		closing := vttClassClosingPattern.FindStringIndex(s.Lines[last])
+		if len(starter) > 0 && closing != nil {
+			for _, class := range strings.Split(starter[1][1:], ".") {
+				if _, ok := htmlColorRGB[class]; ok {
+					s.Color = class
+				} else if m := vttRGBClassPattern.FindStringSubmatch(class); len(m) > 0 {
+					s.Color = "#" + m[1]
+				}
+			}
+			if s.Color != "" {
+				s.Lines[last] = s.Lines[last][:closing[0]] // cut off closing first, first and last may be the same line
+				s.Lines[first] = s.Lines[first][len(starter[0]):]
+			}
+		}
+	}
+
+	for i, line := range s.Lines {
+		s.Lines[i] = vttUnescaper.Replace(line)
+	}
+
+	return s
+}
+
+// parseVttSettings parses cue settings and returns the position they describe.
+// Returns PosNotSpecified if there are no position related settings.
+func parseVttSettings(settings string) Pos {
+	row, col := 0, 1 // Default is bottom center
+	specified := false
+
+	// parsePercent parses a percentage value, and returns its third (0, 1 or 2).
+	parsePercent := func(v string) (int, bool) {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case f < 100.0/3:
+			return 0, true
+		case f <= 200.0/3:
+			return 1, true
+		}
+		return 2, true
+	}
+
+	alignSet := false
+	for _, setting := range strings.Fields(settings) {
+		i := strings.IndexByte(setting, ':')
+		if i < 0 {
+			continue
+		}
+		name, value := setting[:i], setting[i+1:]
+		if j := strings.IndexByte(value, ','); j >= 0 {
+			value = value[:j] // Cut off alignment, e.g. "50%,center"
+		}
+		switch name {
+		case "line":
+			if strings.HasSuffix(value, "%") {
+				if third, ok := parsePercent(value); ok {
+					row, specified = 2-third, true // Percentage is counted from the top
+				}
+			} else if n, err := strconv.Atoi(value); err == nil {
+				// Line numbers are counted from the top if positive, from the bottom if negative
+				if n >= 0 {
+					row = 2
+				} else {
+					row = 0
+				}
+				specified = true
+			}
+		case "position":
+			if alignSet {
+				break // align has precedence
+			}
+			if third, ok := parsePercent(value); ok {
+				col, specified = third, true
+			}
+		case "align":
+			switch value {
+			case "start", "left":
+				col = 0
+			case "center", "middle":
+				col = 1
+			case "end", "right":
+				col = 2
+			default:
+				continue
+			}
+			alignSet, specified = true, true
+		}
+	}
+
+	if !specified {
+		return PosNotSpecified
+	}
+	return posGrid[row][col]
+}
+
+// vttColorClass returns the class name to be used for a color.
+// Returns an empty string if the color is unknown.
+func vttColorClass(color string) string {
+	c := strings.ToLower(strings.TrimPrefix(color, "#"))
+	if _, ok := htmlColorRGB[c]; ok {
+		return c
+	}
+	if len(c) == 6 {
+		if _, err := strconv.ParseUint(c, 16, 32); err == nil {
+			return "rgb" + c
+		}
+	}
+	return ""
+}
+
+// Regexp pattern of tags in cue text: tags of WebVTT (e.g. <c.yellow>, <v Bob>, timestamps)
+// and formatting tags of other formats (e.g. <font color="red">).
+var vttTagPattern = regexp.MustCompile(`<(/?)\s*([a-zA-Z]+|\d[\d:.]*)([^<>]*)>`)
+
+// Tags of cue text supported by WebVTT (timestamps are also supported).
+var vttTags = map[string]bool{"c": true, "i": true, "b": true, "u": true, "v": true, "lang": true, "ruby": true, "rt": true}
+
+// Replacer to escape cue text.
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Replacer to unescape the character references of cue text.
+var vttUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", "\u00a0", "&lrm;", "\u200e", "&rlm;", "\u200f")
+
+// vttCueLine converts a line of subtitle text to WebVTT cue text: text is escaped, <font> tags having a color
+// are converted to <c.color> spans (their classes are passed to addClass), tags not supported by WebVTT are removed.
+// fonts is the stack of <font> tags open in the cue, true elements tell if a span was opened for them.
+func vttCueLine(line string, fonts *[]bool, addClass func(class string)) string {
+	var b strings.Builder
+	start := 0
+	for _, m := range vttTagPattern.FindAllStringSubmatchIndex(line, -1) {
+		b.WriteString(vttEscaper.Replace(line[start:m[0]]))
+		start = m[1]
+		slash, name := line[m[2]:m[3]], strings.ToLower(line[m[4]:m[5]])
+		switch {
+		case name == "font":
+			if slash != "" {
+				if n := len(*fonts); n > 0 {
+					if (*fonts)[n-1] {
+						b.WriteString("</c>")
+					}
+					*fonts = (*fonts)[:n-1]
+				}
+				continue
+			}
+			class := ""
+			if parts := fontColorPattern.FindStringSubmatch(line[m[6]:m[7]]); len(parts) > 0 {
+				class = vttColorClass(parts[1])
+			}
+			*fonts = append(*fonts, class != "")
+			if class != "" {
+				addClass(class)
+				b.WriteString("<c." + class + ">")
+			}
+		case name == "i" || name == "b" || name == "u":
+			b.WriteString("<" + slash + name + ">") // Attributes are not supported
+		case vttTags[name] || name[0] >= '0' && name[0] <= '9':
+			b.WriteString(line[m[0]:m[1]])
+		}
+		// Other tags are not supported by WebVTT, they are removed
+	}
+	b.WriteString(vttEscaper.Replace(line[start:]))
+	return b.String()
+}
+
+// WriteVttFile generates WebVTT format (*.vtt) and writes it to a file.
+func WriteVttFile(name string, sp *SubsPack) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	debugf("Writing %d subtitles to file: %s", len(sp.Subs), name)
+	return WriteVttTo(f, sp)
+}
+
+// WriteVttTo generates WebVTT format (*.vtt) and writes it to an io.Writer.
+func WriteVttTo(w io.Writer, sp *SubsPack) error {
+	wr := &writer{w: w}
+
+	// BOM
+	wr.pr("\xef\xbb\xbf")
+
+	// Header
+	wr.prn("WEBVTT")
+	wr.prn()
+
+	// Preserved blocks
+	for _, block := range sp.VttBlocks {
+		for _, line := range strings.Split(block, "\n") {
+			wr.prn(line)
+		}
+		wr.prn()
+	}
+
+	// Cue texts and the color classes they use (of the subtitle colors and of <font> tags)
+	classes := make([]string, len(sp.Subs)) // Color classes of the subtitles
+	texts := make([][]string, len(sp.Subs))
+	var usedClasses []string
+	used := map[string]bool{}
+	addClass := func(class string) {
+		if !used[class] {
+			used[class] = true
+			usedClasses = append(usedClasses, class)
+		}
+	}
+	for i, s := range sp.Subs {
+		if s.Color != "" {
+			if classes[i] = vttColorClass(s.Color); classes[i] != "" {
+				addClass(classes[i])
+			}
+		}
+		var fonts []bool
+		for _, line := range s.Lines {
+			// An empty line would end the cue
+			if text := vttCueLine(line, &fonts, addClass); strings.TrimSpace(text) != "" {
+				texts[i] = append(texts[i], text)
+			}
+		}
+		if n := len(texts[i]); n > 0 {
+			// Close spans of <font> tags left open
+			for j := len(fonts) - 1; j >= 0; j-- {
+				if fonts[j] {
+					texts[i][n-1] += "</c>"
+				}
+			}
+		}
+	}
+
+	// Generate styles for the color classes not defined by WebVTT
+	styled := map[string]bool{}
+	for _, class := range usedClasses {
+		if vttDefaultColorClasses[class] {
+			continue
+		}
+		if len(styled) == 0 {
+			wr.prn("STYLE")
+			wr.prn(vttGeneratedMarker)
+		}
+		styled[class] = true
+		if m := vttRGBClassPattern.FindStringSubmatch(class); len(m) > 0 {
+			wr.prf("::cue(.%s) { color: #%s; }", class, m[1])
+		} else {
+			wr.prf("::cue(.%s) { color: %s; }", class, class)
+		}
+		wr.prn()
+	}
+	if len(styled) > 0 {
+		wr.prn()
+	}
+
+	printTime := func(t time.Duration) {
+		hour := t / time.Hour
+		min := (t % time.Hour) / time.Minute
+		sec := (t % time.Minute) / time.Second
+		ms := (t % time.Second) / time.Millisecond
+		wr.prf("%02d:%02d:%02d.%03d", hour, min, sec, ms)
+	}
+
+	for i, s := range sp.Subs {
+		if wr.err != nil {
+			break
+		}
+
+		// Cue identifier
+		wr.prn(i + 1)
+
+		// Cue timing and settings
+		printTime(s.TimeIn)
+		wr.pr(" --> ")
+		printTime(s.TimeOut)
+		if settings := modelPosToVttSettings[s.Pos]; settings != "" {
+			wr.pr(" ", settings)
+		}
+		wr.prn()
+
+		// Texts
+		for j, line := range texts[i] {
+			if classes[i] != "" {
+				// If there is color, wrap all lines into a <c>.
+				if j == 0 { // This means opening in first line
+					wr.prf("<c.%s>", classes[i])
+				}
+				wr.pr(line)
+				if j == len(texts[i])-1 { // And closing in the last
+					wr.pr("</c>")
+				}
+				wr.prn()
+			} else {
+				wr.prn(line)
+			}
+		}
+
+		// Separator: empty line
+		wr.prn()
+	}
+
+	return wr.err
+}